@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"code.ottojs.org/tests/load-testing/loadtest"
+)
+
+// maxMultipartFileSize caps every -multipart-file, the body is held in memory
+const maxMultipartFileSize int64 = 10 * 1024 * 1024
+
+// maxBodyPoolFileSize caps the -body-pool file, every body is held in memory
+const maxBodyPoolFileSize int64 = 10 * 1024 * 1024
+
+// weightedBody is a -body-pool entry written as {"body": "...", "weight": 3},
+// without a weight it weighs 1 like a plain string
+type weightedBody struct {
+	Body   *string `json:"body"`
+	Weight *int    `json:"weight"`
+}
+
+// readBodyPool reads a JSON array of body strings or weighted bodies.
+// The weights are nil when no entry has one.
+func readBodyPool(path string) ([][]byte, []int, error) {
+	data, err := readInputFile(path, maxBodyPoolFileSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	entries := []json.RawMessage{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, nil, fmt.Errorf("must be a JSON array: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, nil, errors.New("is empty")
+	}
+	pool := make([][]byte, len(entries))
+	weights := make([]int, len(entries))
+	weighted := false
+	for i, entry := range entries {
+		var body string
+		if err := json.Unmarshal(entry, &body); err == nil {
+			pool[i], weights[i] = []byte(body), 1
+			continue
+		}
+		var wb weightedBody
+		if err := json.Unmarshal(entry, &wb); err != nil || wb.Body == nil {
+			return nil, nil, fmt.Errorf(`entry %d must be a string or {"body": "...", "weight": 1}`, i+1)
+		}
+		pool[i], weights[i] = []byte(*wb.Body), 1
+		if wb.Weight != nil {
+			weights[i] = *wb.Weight
+			weighted = true
+		}
+	}
+	if !weighted {
+		weights = nil
+	}
+	return pool, weights, nil
+}
+
+// listFlag collects a flag given several times
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// parsePairs splits name=value flags into url.Values
+func parsePairs(pairs []string) (url.Values, error) {
+	values := url.Values{}
+	for _, pair := range pairs {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%q must look like name=value", pair)
+		}
+		values.Add(name, value)
+	}
+	return values, nil
+}
+
+// buildBody encodes the -form or -multipart-field/-multipart-file flags,
+// returning the body and its Content-Type, or a nil body when none are set
+func buildBody(form []string, fields []string, files []string) ([]byte, string, error) {
+	if len(form) > 0 && len(fields)+len(files) > 0 {
+		return nil, "", errors.New("-form and -multipart-field/-multipart-file cannot be combined")
+	}
+	if len(form) > 0 {
+		values, err := parsePairs(form)
+		if err != nil {
+			return nil, "", err
+		}
+		body, contentType := loadtest.FormBody(values)
+		return body, contentType, nil
+	}
+	if len(fields)+len(files) == 0 {
+		return nil, "", nil
+	}
+	values, err := parsePairs(fields)
+	if err != nil {
+		return nil, "", err
+	}
+	parts := []loadtest.MultipartFile{}
+	for _, pair := range files {
+		field, path, ok := strings.Cut(pair, "=")
+		if !ok || field == "" {
+			return nil, "", fmt.Errorf("%q must look like name=path", pair)
+		}
+		content, err := readInputFile(path, maxMultipartFileSize)
+		if err != nil {
+			return nil, "", err
+		}
+		parts = append(parts, loadtest.MultipartFile{Field: field, Filename: filepath.Base(path), Content: content})
+	}
+	return loadtest.MultipartBody(values, parts)
+}
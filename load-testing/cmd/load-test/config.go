@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	"code.ottojs.org/tests/load-testing/loadtest"
+)
+
+// newConfig fills in a loadtest.Config attacking uri from the settings at the
+// top of main.go and the flags, and validates it
+func newConfig(opts *attackOptions, uri string) (loadtest.Config, error) {
+	// You can test POST requests with:
+	// Method: "POST",
+	// Body: []byte(`{"email":"user@example.com"}`),
+	cfg := loadtest.Config{
+		Name:                    opts.name,
+		URI:                     uri,
+		Method:                  "GET",
+		Rate:                    TEST_RATE,
+		RatePer:                 TEST_RATE_PER,
+		Duration:                TEST_SECONDS * time.Second,
+		Timeout:                 TEST_TIMEOUT * time.Second,
+		SoftTimeout:             TEST_SOFT_TIMEOUT,
+		RawURL:                  TEST_RAW_URL,
+		ExpectContentType:       TEST_EXPECT_CONTENT_TYPE,
+		MeasureTLSHandshake:     TEST_MEASURE_TLS_HANDSHAKE,
+		MeasureLatencyBreakdown: TEST_LATENCY_BREAKDOWN,
+		MeasureConnWait:         TEST_MEASURE_CONN_WAIT,
+		NetworkSim: loadtest.NetworkSimConfig{
+			ExtraLatency: TEST_SIM_EXTRA_LATENCY_MS * time.Millisecond,
+			DropRate:     TEST_SIM_DROP_RATE,
+		},
+		Fuzz: loadtest.FuzzConfig{
+			Mode: TEST_FUZZ_MODE,
+			Rate: TEST_FUZZ_RATE,
+		},
+		ChaosHeader: loadtest.ChaosHeader{
+			Name:   TEST_CHAOS_HEADER,
+			Values: splitList(TEST_CHAOS_VALUES),
+		},
+		SuccessBodyRegex: TEST_SUCCESS_BODY_REGEX,
+		FailureBodyRegex: TEST_FAILURE_BODY_REGEX,
+		TLS: loadtest.TLSConfig{
+			MinVersion:   TEST_TLS_MIN_VERSION,
+			MaxVersion:   TEST_TLS_MAX_VERSION,
+			CipherSuites: splitList(TEST_TLS_CIPHER_SUITES),
+			ServerName:   TEST_TLS_SERVER_NAME,
+		},
+		KeepAlive:             TEST_KEEP_ALIVE,
+		MaxIdleConnsPerHost:   TEST_MAX_IDLE_CONNS,
+		MaxConnsPerHost:       TEST_MAX_CONNS_PER_HOST,
+		MaxTotalConns:         TEST_MAX_TOTAL_CONNS,
+		Deadline:              opts.deadline,
+		MaxBytesIn:            TEST_MAX_BYTES_IN,
+		HostHeader:            TEST_HOST_HEADER,
+		DefaultContentType:    TEST_DEFAULT_CONTENT_TYPE,
+		IPVersion:             TEST_IP_VERSION,
+		DisableTCPNoDelay:     !TEST_TCP_NODELAY,
+		ReadBufferSize:        TEST_READ_BUFFER_SIZE,
+		WriteBufferSize:       TEST_WRITE_BUFFER_SIZE,
+		RetryAfter:            TEST_RETRY_AFTER,
+		Workers:               TEST_WORKERS,
+		MaxWorkers:            TEST_MAX_WORKERS,
+		ResultBuffer:          TEST_RESULT_BUFFER,
+		CapWorkersToFileLimit: TEST_CAP_WORKERS_TO_FILE_LIMIT,
+		MinSamples:            TEST_MIN_SAMPLES,
+		RateTolerance:         TEST_RATE_TOLERANCE,
+		ShutdownTimeout:       TEST_SHUTDOWN_TIMEOUT * time.Second,
+		MaxErrorSamples:       TEST_MAX_ERROR_SAMPLES,
+		ExcludeFirst:          TEST_EXCLUDE_FIRST_SECONDS * time.Second,
+		ErrorWindow:           opts.errorWindow,
+		RampBand:              opts.rampBand,
+		SnapshotInterval:      opts.snapshotInterval,
+		LatencyUnit:           opts.latencyUnit,
+		LatenciesMs:           opts.latenciesMs,
+		LiveAlert: loadtest.LiveAlertConfig{
+			P99:      opts.alertP99,
+			Window:   opts.alertWindow,
+			Cooldown: opts.alertCooldown,
+		},
+		Thresholds: loadtest.Thresholds{
+			MinThroughput: opts.minThroughput,
+			MinRate:       opts.minRate,
+			MaxP99:        opts.maxP99,
+
+			FailOnEmptyBody:     TEST_FAIL_ON_EMPTY_BODY,
+			ReliablePercentiles: opts.requireMinSamples,
+		},
+	}
+	if opts.headersFile != "" {
+		data, err := readInputFile(opts.headersFile, loadtest.MaxHeadersFileSize)
+		if err != nil {
+			return cfg, fmt.Errorf("-headers-file: %w", err)
+		}
+		if cfg.Header, err = loadtest.ParseHeaders(data); err != nil {
+			return cfg, fmt.Errorf("-headers-file: %w", err)
+		}
+	}
+	if opts.bodyPool != "" {
+		if len(cfg.Body) > 0 || len(opts.form)+len(opts.multipartFields)+len(opts.multipartFiles) > 0 {
+			return cfg, errors.New("-body-pool: cannot be combined with Body, -form or -multipart-*")
+		}
+		pool, weights, err := readBodyPool(opts.bodyPool)
+		if err != nil {
+			return cfg, fmt.Errorf("-body-pool: %w", err)
+		}
+		if deduped, dedupedWeights, duplicates := loadtest.DedupeBodyPool(pool, weights); duplicates > 0 {
+			if opts.bodyPoolDedupe {
+				fmt.Printf("Body pool: dropped %d duplicate bodies, %d left\n", duplicates, len(deduped))
+				pool, weights = deduped, dedupedWeights
+			} else {
+				fmt.Printf("Warning: -body-pool has %d bodies identical to an earlier one, which sends them more often.\n", duplicates)
+				fmt.Printf("Use weights to send a body more often on purpose, or -body-pool-dedupe to drop the duplicates\n")
+			}
+		}
+		if cfg.Method == "GET" {
+			cfg.Method = "POST"
+		}
+		cfg.BodyPool = pool
+		cfg.BodyWeights = weights
+		cfg.BodyPoolRandom = opts.bodyPoolRandom
+	} else if opts.bodyPoolRandom {
+		return cfg, errors.New("-body-pool-random: needs -body-pool")
+	}
+	if body, contentType, err := buildBody(opts.form, opts.multipartFields, opts.multipartFiles); err != nil {
+		return cfg, fmt.Errorf("body: %w", err)
+	} else if body != nil {
+		if len(cfg.Body) > 0 {
+			return cfg, errors.New("body: Body is set in the code, remove it to use -form or -multipart-*")
+		}
+		if cfg.Method == "GET" {
+			cfg.Method = "POST"
+		}
+		if cfg.Header == nil {
+			cfg.Header = http.Header{}
+		}
+		cfg.Body = body
+		cfg.Header.Set("Content-Type", contentType)
+	}
+	if opts.bodyFile != "" {
+		if len(cfg.Body) > 0 || len(cfg.BodyPool) > 0 {
+			return cfg, errors.New("-body-file: cannot be combined with Body, -body-pool, -form or -multipart-*")
+		}
+		if cfg.Method == "GET" {
+			cfg.Method = "POST"
+		}
+		cfg.BodyFile = opts.bodyFile
+	}
+	if TEST_RATE_PER_CORE {
+		cfg.Rate = TEST_RATE * runtime.NumCPU()
+	}
+	if opts.rateFile != "" {
+		data, err := readInputFile(opts.rateFile, loadtest.MaxRateScheduleSize)
+		if err != nil {
+			return cfg, fmt.Errorf("-rate-file: %w", err)
+		}
+		if cfg.RateSchedule, err = loadtest.ParseRateSchedule(data); err != nil {
+			return cfg, fmt.Errorf("-rate-file: %w", err)
+		}
+		cfg.RateScheduleLoop = opts.rateFileLoop
+	}
+	if opts.harFile != "" {
+		if opts.rateFile != "" || len(cfg.Body) > 0 || len(cfg.BodyPool) > 0 {
+			return cfg, errors.New("-har: cannot be combined with -rate-file, Body, -body-pool, -form or -multipart-*")
+		}
+		data, err := readInputFile(opts.harFile, loadtest.MaxHARSize)
+		if err != nil {
+			return cfg, fmt.Errorf("-har: %w", err)
+		}
+		if cfg.Replay, err = loadtest.ParseHAR(data); err != nil {
+			return cfg, fmt.Errorf("-har: %w", err)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return cfg, fmt.Errorf("config: %w", err)
+	}
+	return cfg, nil
+}
+
+// printConfig prints the target, the rate and the connection settings before the countdown
+func printConfig(cfg loadtest.Config, opts *attackOptions) {
+	fmt.Println("Attack:", cfg.AttackName())
+	if TEST_RATE_PER_CORE {
+		fmt.Printf("Rate: %d per core x %d cores = %d\n", TEST_RATE, runtime.NumCPU(), cfg.Rate)
+	}
+	fmt.Println("Targeting", cfg.URI, "with", cfg.Rate, "connections for", cfg.Duration, "seconds...")
+	if cfg.HostHeader != "" {
+		fmt.Println("Host header:", cfg.HostHeader)
+	}
+	if len(cfg.Replay) > 0 {
+		last := cfg.Replay[len(cfg.Replay)-1].At
+		fmt.Printf("Replay: %d requests over %s from %s, %.2f/s on average\n", len(cfg.Replay), last.Round(time.Millisecond), opts.harFile, cfg.RatePerSecond())
+		if last >= cfg.Duration {
+			fmt.Printf("Only the requests in the first %s are sent, raise TEST_SECONDS to replay all of them\n", cfg.Duration)
+		}
+	} else if len(cfg.RateSchedule) > 0 {
+		end := "stopping at its end"
+		if cfg.RateScheduleLoop {
+			end = "starting over at its end"
+		}
+		fmt.Printf("Rate: %d seconds from %s, %.2f/s on average, %s\n", len(cfg.RateSchedule), opts.rateFile, cfg.RatePerSecond(), end)
+	} else if cfg.RatePer != time.Second {
+		fmt.Printf("Rate: %d requests per %s (%.2f/s)\n", cfg.Rate, cfg.RatePer, cfg.RatePerSecond())
+	}
+	if cfg.KeepAlive {
+		idle := "Vegeta's default"
+		if cfg.MaxIdleConnsPerHost > 0 {
+			idle = fmt.Sprint(cfg.MaxIdleConnsPerHost)
+		}
+		fmt.Println("Connection pool: keep-alive on, max idle connections per host", idle)
+	} else {
+		fmt.Println("Connection pool: keep-alive off, every request opens a new connection")
+	}
+	if cfg.MaxConnsPerHost > 0 || cfg.MaxTotalConns > 0 {
+		fmt.Printf("Connection pool: max connections per host %s, in total %s\n", connLimit(cfg.MaxConnsPerHost), connLimit(cfg.MaxTotalConns))
+	}
+	if cfg.IPVersion != "" {
+		fmt.Printf("Connections: IPv%s only\n", cfg.IPVersion)
+	}
+	if cfg.DisableTCPNoDelay {
+		fmt.Println("Connections: TCP_NODELAY off, Nagle's algorithm delays small writes")
+	}
+	if cfg.TLS.MinVersion != "" || cfg.TLS.MaxVersion != "" || len(cfg.TLS.CipherSuites) > 0 || cfg.TLS.ServerName != "" {
+		fmt.Println("TLS: versions", orDefault(cfg.TLS.MinVersion), "to", orDefault(cfg.TLS.MaxVersion), "cipher suites", orDefault(strings.Join(cfg.TLS.CipherSuites, ", ")), "server name", orDefault(cfg.TLS.ServerName))
+	}
+	if cfg.NetworkSim.ExtraLatency > 0 || cfg.NetworkSim.DropRate > 0 {
+		fmt.Println("Network simulation: extra latency", cfg.NetworkSim.ExtraLatency, "drop rate", cfg.NetworkSim.DropRate)
+	}
+	if maxWorkers := cfg.EffectiveMaxWorkers(); maxWorkers != cfg.MaxWorkers {
+		fmt.Println("Workers: capped at", maxWorkers, "to fit the open file limit")
+	}
+}
+
+// connLimit describes a connection limit, 0 is unlimited
+func connLimit(limit int) string {
+	if limit == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprint(limit)
+}
+
+// splitList splits a comma separated setting, ignoring empty entries
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// orDefault describes an empty setting as Go's default
+func orDefault(value string) string {
+	if value == "" {
+		return "default"
+	}
+	return value
+}
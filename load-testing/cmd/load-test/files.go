@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// validateOutputPath checks a file can be written at path
+// without replacing a directory or creating missing directories
+func validateOutputPath(path string) error {
+	if path == "" {
+		return errors.New("path is empty")
+	}
+	clean := filepath.Clean(path)
+	if info, err := os.Stat(clean); err == nil && info.IsDir() {
+		return fmt.Errorf("%s is a directory", clean)
+	}
+	dir := filepath.Dir(clean)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("directory %s does not exist", dir)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
+}
+
+// readInputFile reads a regular file of at most maxSize bytes
+func readInputFile(path string, maxSize int64) ([]byte, error) {
+	if path == "" {
+		return nil, errors.New("path is empty")
+	}
+	clean := filepath.Clean(path)
+	info, err := os.Stat(clean)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", clean)
+	}
+	if info.Size() > maxSize {
+		return nil, fmt.Errorf("%s is %d bytes, the limit is %d", clean, info.Size(), maxSize)
+	}
+	return os.ReadFile(clean)
+}
+
+// createOutputFile validates path and creates (or truncates) the file
+func createOutputFile(path string) (*os.File, error) {
+	if err := validateOutputPath(path); err != nil {
+		return nil, err
+	}
+	return os.Create(filepath.Clean(path))
+}
+
+// snapshotPath names the nth snapshot file, numbered so they sort in order
+func snapshotPath(dir string, n int) string {
+	return filepath.Join(dir, fmt.Sprintf("snapshot-%04d.json", n))
+}
+
+// writeJSON writes v to a new file at path, used for -snapshot-interval and -repeat-output
+func writeJSON(path string, v any) error {
+	data, err := marshalJSON(v)
+	if err != nil {
+		return err
+	}
+	file, err := createOutputFile(path)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
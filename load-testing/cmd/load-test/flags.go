@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"code.ottojs.org/tests/load-testing/loadtest"
+)
+
+// attackOptions are the flags of a load test, the settings at the top of
+// main.go are constants instead
+type attackOptions struct {
+	name              string
+	encodePath        string
+	headersFile       string
+	repeat            int
+	repeatOutput      string
+	rateFile          string
+	rateFileLoop      bool
+	harFile           string
+	bodyPool          string
+	bodyPoolRandom    bool
+	bodyPoolDedupe    bool
+	bodyFile          string
+	form              listFlag
+	multipartFields   listFlag
+	multipartFiles    listFlag
+	snapshotInterval  time.Duration
+	snapshotDir       string
+	errorWindow       time.Duration
+	rampBand          float64
+	minThroughput     float64
+	maxP99            time.Duration
+	minRate           float64
+	webhook           string
+	webhookHeader     string
+	checkDNS          bool
+	latencyUnit       string
+	latenciesMs       bool
+	streamAddr        string
+	markdown          bool
+	markdownOutput    string
+	jsonCompact       bool
+	statsd            string
+	statsdPrefix      string
+	requireMinSamples bool
+	alertP99          time.Duration
+	alertWindow       time.Duration
+	alertCooldown     time.Duration
+	deadline          time.Duration
+	historyDir        string
+	historyRuns       int
+	historySigma      float64
+	precision         int
+	uploadRequired    bool
+	mock              bool
+	mockOptions       selftestOptions
+}
+
+// register adds the options to flags
+func (o *attackOptions) register(flags *flag.FlagSet) {
+	flags.StringVar(&o.name, "name", loadtest.AttackName, "Attack name stored in every result, tells attacks apart in vegeta report and plot")
+	flags.StringVar(&o.encodePath, "encode", "", "Also write every result to this file in Vegeta's gob encoding (for vegeta report, plot, etc.)")
+	flags.StringVar(&o.headersFile, "headers-file", "", `Send the headers in this file, JSON {"Name": "value"} or "Name: value" lines`)
+	flags.IntVar(&o.repeat, "repeat", 1, "Run the test this many times and report how the percentiles vary between runs")
+	flags.StringVar(&o.repeatOutput, "repeat-output", "", "Write every run and the aggregate percentiles of -repeat to this JSON file")
+	flags.StringVar(&o.rateFile, "rate-file", "", "Replay the requests per second in this file, one value per line for each second, instead of TEST_RATE")
+	flags.BoolVar(&o.rateFileLoop, "rate-file-loop", false, "Start -rate-file over at its end instead of stopping the test")
+	flags.StringVar(&o.harFile, "har", "", "Replay the requests of this HAR file, exported from a browser, with their original timing instead of TEST_URI and TEST_RATE. Every request must be on the TEST_URI scheme, host and port")
+	flags.StringVar(&o.bodyPool, "body-pool", "", `Send the bodies in this JSON array of strings in turn, ["{\"id\":1}", "{\"id\":2}"]. Switches GET to POST`)
+	flags.BoolVar(&o.bodyPoolRandom, "body-pool-random", false, "Pick a -body-pool body at random for every request, in proportion to the weights, instead of in turn")
+	flags.BoolVar(&o.bodyPoolDedupe, "body-pool-dedupe", false, "Drop -body-pool bodies identical to an earlier one instead of warning about them")
+	flags.StringVar(&o.bodyFile, "body-file", "", "Stream this file as the body of every request without loading it into memory, for large uploads. Switches GET to POST")
+	flags.Var(&o.form, "form", "Send a form body field, name=value, can be repeated. Switches GET to POST")
+	flags.Var(&o.multipartFields, "multipart-field", "Send a multipart body field, name=value, can be repeated. Switches GET to POST")
+	flags.Var(&o.multipartFiles, "multipart-file", "Send a file in a multipart body, name=path, can be repeated. Switches GET to POST")
+	flags.DurationVar(&o.snapshotInterval, "snapshot-interval", 0, "Write the results of every interval to a JSON file during the run, for example 5m")
+	flags.StringVar(&o.snapshotDir, "snapshot-dir", ".", "Directory for the -snapshot-interval files")
+	flags.DurationVar(&o.errorWindow, "error-window", 0, "Report the error rate over time in windows of this length, for example 5s")
+	flags.Float64Var(&o.rampBand, "ramp-band", 0, "Report latency and errors per band of configured rate this many requests per second wide, for example 100 with -rate-file")
+	flags.Float64Var(&o.minThroughput, "min-throughput", 0, "Fail if successful requests per second is below this")
+	flags.DurationVar(&o.maxP99, "max-p99", 0, "Fail if the 99th percentile latency is above this, for example 250ms")
+	flags.Float64Var(&o.minRate, "min-rate", 0, "Fail if requests sent per second is below this")
+	flags.StringVar(&o.webhook, "webhook", "", "POST the JSON results to this URL after the run")
+	flags.StringVar(&o.webhookHeader, "webhook-header", "", `Extra header for -webhook, for example "Authorization: Bearer TOKEN"`)
+	flags.BoolVar(&o.checkDNS, "check-dns", false, "Fail before the countdown if the TEST_URI host name does not resolve")
+	flags.StringVar(&o.latencyUnit, "latency-unit", loadtest.LatencyUnitString, `Unit of the latencies in the JSON results: "string" ("12.3ms"), "ms" (12.3) or "ns" (12300000)`)
+	flags.BoolVar(&o.latenciesMs, "latencies-ms", false, "Add latenciesMs to the JSON results, the latencies as numbers of milliseconds")
+	flags.StringVar(&o.streamAddr, "stream-addr", "", "Publish every result as a line of JSON to clients connecting to this TCP host:port or unix:/path/to.sock during the attack")
+	flags.BoolVar(&o.markdown, "markdown", false, "Also print the results as Markdown tables, for pull requests and wikis")
+	flags.StringVar(&o.markdownOutput, "markdown-output", "", "Write the -markdown tables to this file instead of printing them")
+	flags.BoolVar(&o.jsonCompact, "json-compact", false, "Also print the results as a single line of JSON, for log shippers")
+	flags.StringVar(&o.statsd, "statsd", "", "Send the results as StatsD metrics over UDP to this host:port after the run")
+	flags.StringVar(&o.statsdPrefix, "statsd-prefix", "loadtest", "Prefix of the -statsd metric names")
+	flags.BoolVar(&o.requireMinSamples, "require-min-samples", false, "Fail if there were too few requests for reliable percentiles (TEST_MIN_SAMPLES)")
+	flags.DurationVar(&o.alertP99, "alert-p99", 0, "Print an alert (and POST it to -webhook) during the run when the rolling p99 latency goes above this, for example 500ms")
+	flags.DurationVar(&o.alertWindow, "alert-window", loadtest.DefaultAlertWindow, "Rolling window of -alert-p99")
+	flags.DurationVar(&o.alertCooldown, "alert-cooldown", time.Minute, "Minimum time between -alert-p99 alerts")
+	flags.DurationVar(&o.deadline, "deadline", 0, "Stop the run after this long no matter what, including waiting for slow responses, for example 2m. Must be longer than TEST_SECONDS")
+	flags.StringVar(&o.historyDir, "history-dir", "", "Compare the latencies to the previous runs kept in this directory and add this run to it")
+	flags.IntVar(&o.historyRuns, "history-runs", 10, "Number of previous -history-dir runs to compare to")
+	flags.Float64Var(&o.historySigma, "history-sigma", 2, "Fail if a percentile is more than this many standard deviations above the -history-dir mean")
+	flags.IntVar(&o.precision, "precision", -1, "Round rates to this many decimal places and latencies to this many decimal places of a millisecond in the printed and JSON results, up to 9, -1 keeps full precision")
+	flags.BoolVar(&o.uploadRequired, "upload-required", false, "Fail the run if the -webhook upload fails instead of warning")
+	flags.BoolVar(&o.mock, "mock", false, "Attack the echo server of serve-mock in this process instead of TEST_URI, shaped by the -mock-* flags, and skip the countdown")
+	o.mockOptions.register(flags, "mock-")
+}
+
+// validate checks the flags that do not end up in the loadtest.Config,
+// Config.Validate checks the others
+func (o *attackOptions) validate() error {
+	if o.statsd != "" {
+		if err := validateStatsd(o.statsd); err != nil {
+			return fmt.Errorf("-statsd: %w", err)
+		}
+	}
+	if o.repeat < 1 {
+		return fmt.Errorf("-repeat: must be at least 1, got %d", o.repeat)
+	}
+	if o.precision < -1 || o.precision > loadtest.MaxPrecision {
+		return fmt.Errorf("-precision: must be -1 or 0 to %d, got %d", loadtest.MaxPrecision, o.precision)
+	}
+	if o.repeatOutput != "" {
+		if err := validateOutputPath(o.repeatOutput); err != nil {
+			return fmt.Errorf("-repeat-output path: %w", err)
+		}
+	}
+	if o.markdownOutput != "" {
+		if err := validateOutputPath(o.markdownOutput); err != nil {
+			return fmt.Errorf("-markdown-output path: %w", err)
+		}
+	}
+	if o.webhook != "" {
+		if err := validateWebhook(o.webhook, o.webhookHeader); err != nil {
+			return fmt.Errorf("-webhook: %w", err)
+		}
+	}
+	if o.snapshotInterval > 0 {
+		if err := validateOutputPath(snapshotPath(o.snapshotDir, 1)); err != nil {
+			return fmt.Errorf("-snapshot-dir: %w", err)
+		}
+	}
+	if o.historyDir != "" {
+		if err := validateHistoryDir(o.historyDir); err != nil {
+			return fmt.Errorf("-history-dir: %w", err)
+		}
+		if o.historyRuns < loadtest.MinHistoryRuns || o.historySigma <= 0 {
+			return fmt.Errorf("-history-dir: -history-runs must be at least %d and -history-sigma positive", loadtest.MinHistoryRuns)
+		}
+	}
+	return nil
+}
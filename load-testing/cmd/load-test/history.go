@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"code.ottojs.org/tests/load-testing/loadtest"
+)
+
+// historyFileSize caps a -history-dir file, a run takes about 150 bytes
+const historyFileSize int64 = 64 * 1024
+
+// validateHistoryDir checks runs can be read from and written to dir
+func validateHistoryDir(dir string) error {
+	return validateOutputPath(historyPath(dir, time.Now()))
+}
+
+// historyPath names the file of the run at t, named so they sort in order
+func historyPath(dir string, t time.Time) string {
+	return filepath.Join(dir, "run-"+t.UTC().Format("20060102-150405.000")+".json")
+}
+
+// loadHistory reads the latest n runs of dir, newest first.
+// Files that cannot be read are skipped and counted.
+func loadHistory(dir string, n int) ([]loadtest.HistoryRun, int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if name := entry.Name(); entry.Type().IsRegular() && strings.HasPrefix(name, "run-") && strings.HasSuffix(name, ".json") {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	slices.Reverse(names)
+	runs := []loadtest.HistoryRun{}
+	skipped := 0
+	for _, name := range names {
+		if len(runs) == n {
+			break
+		}
+		data, err := readInputFile(filepath.Join(dir, name), historyFileSize)
+		if err != nil {
+			skipped++
+			continue
+		}
+		var run loadtest.HistoryRun
+		if err := json.Unmarshal(data, &run); err != nil || run.Requests == 0 {
+			skipped++
+			continue
+		}
+		runs = append(runs, run)
+	}
+	return runs, skipped, nil
+}
+
+// compareHistory prints how the run compares to the previous runs in dir,
+// returns a failure for every regressed percentile and adds the run to dir
+// unless it regressed, so one slow run does not widen the limits of the next
+func compareHistory(dir string, n int, sigmas float64, results loadtest.Results) ([]string, error) {
+	history, skipped, err := loadHistory(dir, n)
+	if err != nil {
+		return nil, err
+	}
+	current := loadtest.NewHistoryRun(results, time.Now())
+	comparisons := loadtest.CompareHistory(current, history, sigmas)
+
+	fmt.Printf("===== History =====\n")
+	if skipped > 0 {
+		fmt.Printf("Skipped %d unreadable files in %s\n", skipped, dir)
+	}
+	failures := []string{}
+	if comparisons == nil {
+		fmt.Printf("%d previous runs in %s, comparing needs at least %d\n", len(history), dir, loadtest.MinHistoryRuns)
+	}
+	for _, c := range comparisons {
+		verdict := "ok"
+		if c.Regressed {
+			verdict = "REGRESSION"
+			failures = append(failures, fmt.Sprintf("%s latency %.2fms is more than %g standard deviations above the last %d runs (mean %.2fms, limit %.2fms)",
+				c.Percentile, c.Current, sigmas, c.Runs, c.Mean, c.Limit))
+		}
+		fmt.Printf("%s: %.2fms vs %.2fms ± %.2fms over %d runs, limit %.2fms  %s\n", c.Percentile, c.Current, c.Mean, c.StdDev, c.Runs, c.Limit, verdict)
+	}
+	if len(failures) > 0 {
+		fmt.Printf("This run is not added to the history, clear the runs in %s after an intended change\n", dir)
+	}
+	fmt.Printf("\n")
+
+	// Interrupted runs do not describe a full test, keep them out of the history
+	if results.Interrupted || results.Requests == 0 || len(failures) > 0 {
+		return failures, nil
+	}
+	if err := writeJSON(historyPath(dir, current.Time), current); err != nil {
+		return failures, fmt.Errorf("saving the run: %w", err)
+	}
+	return failures, nil
+}
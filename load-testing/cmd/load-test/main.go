@@ -1,10 +1,22 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"code.ottojs.org/tests/load-testing/loadtest"
 	vegeta "github.com/tsenart/vegeta/v12/lib"
 )
 
@@ -12,69 +24,598 @@ import (
 const TEST_URI string = "http://localhost/"
 const TEST_SECONDS time.Duration = 10
 const TEST_RATE int = 150
-const TEST_TIMEOUT time.Duration = 5 // seconds
+const TEST_RATE_PER time.Duration = time.Second    // unit of TEST_RATE, for example time.Minute for 30 per minute
+const TEST_RATE_PER_CORE bool = false              // TEST_RATE is per CPU core of this machine, so the load scales with its size
+const TEST_TIMEOUT time.Duration = 5               // seconds
+const TEST_SOFT_TIMEOUT bool = false               // count requests that run out of TEST_TIMEOUT as slow, not as failures
+const TEST_RAW_URL bool = false                    // send the path exactly as written, see notes/url_normalization.md
+const TEST_KEEP_ALIVE bool = false                 // reuse connections between requests
+const TEST_MAX_IDLE_CONNS int = 0                  // per host, used with TEST_KEEP_ALIVE, 0 uses Vegeta's default (10000)
+const TEST_MAX_CONNS_PER_HOST int = 0              // open connections per host, requests beyond it wait for a free one, 0 is unlimited
+const TEST_MAX_TOTAL_CONNS int = 0                 // open connections to all hosts together, 0 is unlimited
+const TEST_HOST_HEADER string = ""                 // Host header instead of the TEST_URI host, for example "api.example.com" when TEST_URI is an IP
+const TEST_DEFAULT_CONTENT_TYPE string = ""        // Content-Type of requests with a body and no Content-Type header, for example "application/json"
+const TEST_IP_VERSION string = ""                  // "4" or "6" forces IPv4 or IPv6 for hosts with both, empty lets Go pick
+const TEST_TCP_NODELAY bool = true                 // send small writes at once, false turns Nagle's algorithm on to measure its effect
+const TEST_READ_BUFFER_SIZE int = 0                // bytes per connection, 0 uses Go's default (4096)
+const TEST_WRITE_BUFFER_SIZE int = 0               // bytes per connection, 0 uses Go's default (4096)
+const TEST_MAX_BYTES_IN int64 = 0                  // stop the test once responses add up to more bytes than this, 0 is unlimited
+const TEST_HEALTH_CHECK_URI string = ""            // GET this URI once before the countdown and stop if it fails, same host as TEST_URI
+const TEST_HEALTH_CHECK_STATUS int = 200           // status TEST_HEALTH_CHECK_URI must respond with
+const TEST_RETRY_AFTER bool = false                // pause when the target responds 429 with Retry-After
+const TEST_WORKERS uint64 = 0                      // initial workers, 0 uses Vegeta's default (10)
+const TEST_MAX_WORKERS uint64 = 0                  // caps workers (and memory) at high rates, 0 is unlimited
+const TEST_CAP_WORKERS_TO_FILE_LIMIT bool = false  // lower TEST_MAX_WORKERS to fit ulimit -n (unix only)
+const TEST_RESULT_BUFFER int = 0                   // results queued for the results loop, rides out short stalls like -encode flushes, 0 is none
+const TEST_ENCODE_BUFFER_SIZE int = 256 * 1024     // bytes buffered before writing to the -encode file
+const TEST_MIN_SAMPLES uint64 = 0                  // fewer requests mark percentiles unreliable, 0 uses 100
+const TEST_RATE_TOLERANCE float64 = 0              // achieved rate this fraction below TEST_RATE is reported, 0 uses 0.1
+const TEST_EXCLUDE_FIRST_SECONDS time.Duration = 0 // leave the results of the first seconds out, for targets that warm up
+const TEST_SHUTDOWN_TIMEOUT time.Duration = 0      // seconds to wait for requests in flight after CTRL+C, 0 waits for all
+const TEST_TLS_MIN_VERSION string = ""             // "1.0", "1.1", "1.2" or "1.3", empty uses Go's default
+const TEST_TLS_MAX_VERSION string = ""             // "1.0", "1.1", "1.2" or "1.3", empty uses Go's default
+const TEST_TLS_SERVER_NAME string = ""             // SNI and certificate name when TEST_URI uses an IP address
+const TEST_TLS_CIPHER_SUITES string = ""           // comma separated crypto/tls names, only apply up to TLS 1.2
+const TEST_SIM_EXTRA_LATENCY_MS time.Duration = 0  // milliseconds added before every request, to simulate a slow network
+const TEST_SIM_DROP_RATE float64 = 0               // fraction of requests failed with a simulated error instead of sent
+const TEST_FUZZ_MODE string = "truncate"           // how TEST_FUZZ_RATE bodies are malformed: "truncate", "duplicate" or "corrupt"
+const TEST_FUZZ_RATE float64 = 0                   // fraction of requests with a body sent malformed, 4xx responses to them are not failures
+const TEST_CHAOS_HEADER string = ""                // header asking a mock server for chaos, for example "X-Chaos-Fail-Rate"
+const TEST_CHAOS_VALUES string = ""                // comma separated TEST_CHAOS_HEADER values sent in turn, for example "0,0.1,0.5"
+const TEST_MEASURE_TLS_HANDSHAKE bool = false      // report TLS handshake durations and connection reuse for https targets
+const TEST_LATENCY_BREAKDOWN bool = false          // report time spent in DNS, connect, TLS, first byte and body transfer
+const TEST_MEASURE_CONN_WAIT bool = false          // report how often and how long requests waited for a connection from the pool
+const TEST_MAX_ERROR_SAMPLES int = 100             // distinct error messages kept, 0 keeps all of them
+const TEST_FAIL_ON_EMPTY_BODY bool = false         // fail the run if any 2xx response has an empty body
+const TEST_EXPECT_CONTENT_TYPE string = ""         // count responses with another media type, for example "application/json"
+const TEST_SUCCESS_BODY_REGEX string = ""          // responses must match this to count as a body success, for example `"data"`
+const TEST_FAILURE_BODY_REGEX string = ""          // responses matching this are body failures, for example `"errors"\s*:`
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == selftestFlag {
+		if err := runSelftestServer(os.Args[2:]); err != nil {
+			fmt.Println("Self-test server failed:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == serveMockCommand {
+		if err := runServeMock(os.Args[2:]); err != nil {
+			fmt.Println("Self-test server failed:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var opts attackOptions
+	opts.register(flag.CommandLine)
+	flag.Usage = usage
+	flag.Parse()
+
+	// The echo server of -mock replaces TEST_URI, it is closed when the process exits
+	var selftestURI string
+	if opts.mock {
+		server, err := startSelftestAttack(&opts.mockOptions)
+		if err != nil {
+			fmt.Println("Invalid -mock:", err)
+			os.Exit(1)
+		}
+		defer server.Close()
+		selftestURI = server.URL + "/"
+	}
+
 	// ######################
 	// ##### Safe Guard #####
-	if TEST_URI == "http://localhost/" {
+	if TEST_URI == "http://localhost/" && selftestURI == "" {
 		fmt.Println("Not performing. Please edit the code to change the URI or remove this block")
 		os.Exit(1)
 	}
 	// ######################
-	duration := TEST_SECONDS * time.Second
-	fmt.Println("Targeting", TEST_URI, "with", TEST_RATE, "connections for", duration, "seconds...")
-	fmt.Println("Stop this process (CTRL+C) within 15 seconds to cancel")
-	time.Sleep(15 * time.Second)
-	fmt.Println("Attacking in progress...")
-
-	rate := vegeta.Rate{
-		Freq: TEST_RATE,
-		Per:  time.Second,
-	}
-	// You can test POST requests with:
-	// Method: "POST",
-	// Body: []byte(`{"email":"user@example.com"}`),
-	targeter := vegeta.NewStaticTargeter(vegeta.Target{
-		Method: "GET",
-		URL:    TEST_URI,
-	})
-	attacker := vegeta.NewAttacker()
-	vegeta.KeepAlive(false)(attacker)
-	vegeta.HTTP2(false)(attacker)
-	vegeta.Redirects(0)(attacker)
-	vegeta.Timeout(TEST_TIMEOUT * time.Second)(attacker)
-
-	var metrics vegeta.Metrics
-	for res := range attacker.Attack(targeter, rate, duration, "Load Test") {
-		metrics.Add(res)
-	}
-	metrics.Close()
+	uri := TEST_URI
+	if selftestURI != "" {
+		uri = selftestURI
+	}
+	cfg, err := newConfig(&opts, uri)
+	if err != nil {
+		fmt.Println("Invalid", err)
+		os.Exit(1)
+	}
+	if err := opts.validate(); err != nil {
+		fmt.Println("Invalid", err)
+		os.Exit(1)
+	}
+	if opts.checkDNS {
+		if err := checkResolves(cfg.URI); err != nil {
+			fmt.Println("Invalid URI:", err)
+			os.Exit(1)
+		}
+	}
+	if TEST_HEALTH_CHECK_URI != "" {
+		if err := loadtest.CheckHealth(cfg, TEST_HEALTH_CHECK_URI, TEST_HEALTH_CHECK_STATUS); err != nil {
+			fmt.Println("Health check failed, not attacking:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Health check passed:", TEST_HEALTH_CHECK_URI)
+	}
+	written, sent, err := loadtest.RequestURIs(cfg.URI)
+	if err != nil {
+		fmt.Println("Invalid URI:", err)
+		os.Exit(1)
+	}
+	if written != sent {
+		if cfg.RawURL {
+			fmt.Println("Note: sending path as written", written, "instead of normalized", sent)
+		} else {
+			fmt.Println("Warning: URI will be sent as", sent, "instead of", written, "(set TEST_RAW_URL to disable)")
+		}
+	}
+	var encoded *bufio.Writer
+	if opts.encodePath != "" {
+		file, err := createOutputFile(opts.encodePath)
+		if err != nil {
+			fmt.Println("Invalid -encode path:", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		// Buffered, at high rates a write per result adds up
+		encoded = bufio.NewWriterSize(file, TEST_ENCODE_BUFFER_SIZE)
+		encoder := vegeta.NewEncoder(encoded)
+		cfg.OnResult = encoder.Encode
+	}
+	if cfg.SnapshotInterval > 0 {
+		snapshots := 0
+		cfg.OnSnapshot = func(results loadtest.Results) error {
+			snapshots++
+			return writeJSON(snapshotPath(opts.snapshotDir, snapshots), results.Round(opts.precision))
+		}
+	}
+	// Alerts are posted in the background so a slow webhook does not hold up the attack
+	var alertUploads sync.WaitGroup
+	cfg.OnAlert = func(alert loadtest.Alert) error {
+		fmt.Fprintf(os.Stderr, "ALERT at %s: p99 %s over the last %s is above %s (%d requests)\n", alert.At.Round(time.Second), alert.P99, alert.Window, alert.Threshold, alert.Requests)
+		if opts.webhook != "" {
+			alertUploads.Add(1)
+			go func() {
+				defer alertUploads.Done()
+				if err := postWebhook(opts.webhook, opts.webhookHeader, alert); err != nil {
+					fmt.Fprintln(os.Stderr, "Warning: alert upload failed:", err)
+				}
+			}()
+		}
+		return nil
+	}
+	printConfig(cfg, &opts)
+	var stream *streamer
+	if opts.streamAddr != "" {
+		if stream, err = newStreamer(opts.streamAddr); err != nil {
+			fmt.Println("Invalid -stream-addr:", err)
+			os.Exit(1)
+		}
+		cfg.OnResult = stream.wrap(cfg.OnResult)
+	}
+
+	if selftestURI == "" {
+		fmt.Println("Stop this process (CTRL+C) within 15 seconds to cancel")
+		time.Sleep(15 * time.Second)
+	}
+	fmt.Println("Attacking in progress... (CTRL+C stops early and prints the results so far)")
+
+	// A live progress line, only on a terminal so logs stay clean
+	var live *progress
+	if isTerminal(os.Stdout) {
+		live = newProgress(cfg, cfg.Duration*time.Duration(opts.repeat))
+		cfg.OnResult = live.wrap(cfg.OnResult)
+		live.start()
+	}
+
+	// kill -USR1 <pid> pauses the attack and kill -USR2 <pid> resumes it
+	cfg.Pauses = pauseSignals()
 
+	// The first CTRL+C stops the attack, a second one exits immediately
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	var results loadtest.Results
+	runs := []loadtest.Results{}
+	for run := 1; run <= opts.repeat; run++ {
+		if results, err = loadtest.RunContext(ctx, cfg); err != nil {
+			break
+		}
+		runs = append(runs, results)
+		if opts.repeat > 1 {
+			if live != nil {
+				fmt.Print("\r\033[K")
+			}
+			fmt.Printf("Run %d/%d: %s\n", run, opts.repeat, results.Summary())
+		}
+		if results.Interrupted {
+			break
+		}
+	}
+	stop()
+	if live != nil {
+		live.stop()
+	}
+	if stream != nil {
+		stream.close()
+	}
+	if encoded != nil {
+		if err := encoded.Flush(); err != nil {
+			fmt.Println("Writing -encode file failed:", err)
+		}
+	}
+	if err != nil {
+		fmt.Println("Load test failed:", err)
+		os.Exit(1)
+	}
+	// Thresholds are checked against the exact results, only the output is rounded
+	exact := results
+	results = results.Round(opts.precision)
+
+	unreliable := ""
+	if !results.Latencies.Reliable {
+		unreliable = " (unreliable)"
+	}
 	fmt.Printf("===== Latencies =====\n")
-	fmt.Printf("Total: %s\n", metrics.Latencies.Total)
-	fmt.Printf("Average: %s\n", metrics.Latencies.Mean)
-	fmt.Printf("Min: %s\n", metrics.Latencies.Min)
-	fmt.Printf("Max: %s\n", metrics.Latencies.Max)
-	fmt.Printf("50th: %s\n", metrics.Latencies.P50)
-	fmt.Printf("90th: %s\n", metrics.Latencies.P90)
-	fmt.Printf("95th: %s\n", metrics.Latencies.P95)
-	fmt.Printf("99th: %s\n", metrics.Latencies.P99)
-	fmt.Printf("Bytes In: %d\n", metrics.BytesIn.Total)
-	fmt.Printf("Bytes Out: %d\n", metrics.BytesOut.Total)
+	fmt.Printf("Samples: %d\n", results.Latencies.Samples)
+	if !results.Latencies.Reliable {
+		fmt.Printf("Warning: too few samples, percentiles are statistically unreliable\n")
+	}
+	fmt.Printf("Total: %s\n", results.Latencies.Total)
+	fmt.Printf("Average: %s\n", results.Latencies.Mean)
+	fmt.Printf("Min: %s\n", results.Latencies.Min)
+	fmt.Printf("Max: %s\n", results.Latencies.Max)
+	fmt.Printf("50th: %s%s\n", results.Latencies.P50, unreliable)
+	fmt.Printf("90th: %s%s\n", results.Latencies.P90, unreliable)
+	fmt.Printf("95th: %s%s\n", results.Latencies.P95, unreliable)
+	fmt.Printf("99th: %s%s\n", results.Latencies.P99, unreliable)
+	fmt.Printf("99.9th: %s%s\n", results.Latencies.P999, tailReliability(results.Latencies.Samples, loadtest.MinSamplesP999))
+	fmt.Printf("99.99th: %s%s\n", results.Latencies.P9999, tailReliability(results.Latencies.Samples, loadtest.MinSamplesP9999))
+	fmt.Printf("Bytes In: %d\n", results.BytesIn)
+	fmt.Printf("Bytes Out: %d\n", results.BytesOut)
+	fmt.Printf("===== Byte Throughput =====\n")
+	fmt.Printf("In: %.0f bytes/s\n", results.ByteThroughput.In)
+	fmt.Printf("Out: %.0f bytes/s\n", results.ByteThroughput.Out)
+	fmt.Printf("===== Response Sizes =====\n")
+	fmt.Printf("Min: %d\n", results.ResponseSizes.Min)
+	fmt.Printf("Average: %.0f\n", results.ResponseSizes.Mean)
+	fmt.Printf("50th: %d\n", results.ResponseSizes.P50)
+	fmt.Printf("99th: %d\n", results.ResponseSizes.P99)
+	fmt.Printf("Max: %d\n", results.ResponseSizes.Max)
+	if tls := results.TLSHandshake; tls != nil {
+		fmt.Printf("===== TLS Handshakes =====\n")
+		fmt.Printf("Handshakes: %d (%d resumed)\n", tls.Handshakes, tls.Resumed)
+		fmt.Printf("Connections: %d new, %d reused\n", tls.NewConnections, tls.ReusedConnections)
+		fmt.Printf("Average: %s\n", tls.Mean)
+		fmt.Printf("50th: %s\n", tls.P50)
+		fmt.Printf("90th: %s\n", tls.P90)
+		fmt.Printf("99th: %s\n", tls.P99)
+		fmt.Printf("Max: %s\n", tls.Max)
+	}
+	if breakdown := results.LatencyBreakdown; breakdown != nil {
+		fmt.Printf("===== Latency Breakdown =====\n")
+		printPhase("DNS", breakdown.DNS)
+		printPhase("Connect", breakdown.Connect)
+		printPhase("TLS", breakdown.TLS)
+		printPhase("TTFB", breakdown.TTFB)
+		printPhase("Transfer", breakdown.Transfer)
+	}
+	if wait := results.ConnWait; wait != nil {
+		fmt.Printf("===== Connection Wait =====\n")
+		var share float64
+		if wait.Requests > 0 {
+			share = float64(wait.Waited) / float64(wait.Requests) * 100
+		}
+		fmt.Printf("Waited: %d of %d requests (%.2f%%) for %s or longer\n", wait.Waited, wait.Requests, share, loadtest.MinConnWait)
+		fmt.Printf("Total: %s\n", wait.Total)
+		if wait.Waited > 0 {
+			printPhase("Wait", wait.Wait)
+		}
+	}
 	fmt.Printf("===== Info =====\n")
-	fmt.Printf("Success: %t\n", metrics.Success == 1)
-	fmt.Printf("Rate: %f\n", metrics.Rate)
-	fmt.Printf("Duration: %s\n", metrics.Duration)
-	fmt.Printf("Wait: %s\n", metrics.Wait)
-	fmt.Printf("Total Requests: %d\n", metrics.Requests)
-	fmt.Printf("Throughput: %f\n", metrics.Throughput)
+	fmt.Printf("Success: %t\n", results.Success == 1)
+	if results.BodyChecked {
+		fmt.Printf("Body Success: %t (%.2f%%, %d failures)\n", results.BodyFailures == 0, results.BodySuccess*100, results.BodyFailures)
+	}
+	fmt.Printf("Rate: %s\n", formatRate(results.Rate, opts.precision))
+	fmt.Printf("Duration: %s\n", results.Duration)
+	fmt.Printf("Wait: %s\n", results.Wait)
+	fmt.Printf("Total Requests: %d\n", results.Requests)
+	if results.IPVersion != "" {
+		fmt.Printf("IP Version: IPv%s\n", results.IPVersion)
+	}
+	if cfg.ExcludeFirst > 0 {
+		fmt.Printf("Excluded: %d requests sent in the first %s\n", results.Excluded, cfg.ExcludeFirst)
+	}
+	fmt.Printf("Throughput: %s\n", formatRate(results.Throughput, opts.precision))
+	if low, high, ok := seriesRange(results.ThroughputSeries); ok {
+		fmt.Printf("Requests Per Second: %d to %d\n", low, high)
+	}
 	fmt.Printf("StatusCodes:\n")
-	for k, v := range metrics.StatusCodes {
+	for k, v := range results.StatusCodes {
 		fmt.Println(k, " => ", v)
 	}
-	fmt.Printf("Errors: %+v\n", metrics.Errors)
+	fmt.Printf("Rate Limited (429): %d\n", results.RateLimited)
+	if results.RateLimited > 0 {
+		fmt.Printf("First 429 sent at: %.1fs\n", results.RateLimiting.FirstAt)
+		fmt.Printf("Retry-After: %d responses, values %v\n", results.RateLimiting.WithRetryAfter, results.RateLimiting.RetryAfter)
+	}
+	if results.EmptyBodies > 0 || cfg.Thresholds.FailOnEmptyBody {
+		fmt.Printf("Empty 2xx Bodies: %d\n", results.EmptyBodies)
+	}
+	if cfg.ExpectContentType != "" {
+		fmt.Printf("Content-Type Mismatches: %d (expected %s)\n", results.ContentTypeMismatches, cfg.ExpectContentType)
+	}
+	if cfg.NetworkSim.DropRate > 0 {
+		fmt.Printf("Simulated Errors: %d (not real failures)\n", results.SimulatedErrors)
+	}
+	if fuzz := results.Fuzz; fuzz != nil {
+		fmt.Printf("Fuzzed Requests: %d %s (%d rejected with 4xx as expected, %d accepted, %d failed)\n",
+			fuzz.Requests, fuzz.Mode, fuzz.Rejected, fuzz.Accepted, fuzz.Failed)
+	}
+	if results.SoftTimeouts {
+		fmt.Printf("Timeouts: %d (TEST_TIMEOUT %s, soft: not counted as failures)\n", results.Timeouts, cfg.Timeout)
+	} else {
+		fmt.Printf("Timeouts: %d (TEST_TIMEOUT %s)\n", results.Timeouts, cfg.Timeout)
+	}
+	if peak, at, ok := seriesPeak(results.TimeoutSeries); ok {
+		first, last := seriesSpan(results.TimeoutSeries)
+		fmt.Printf("Timeouts Over Time: sent between %ds and %ds, peak %d/s at %ds\n", first, last, peak, at)
+	}
+	fmt.Printf("Errors: %+v\n", reportedErrors(results.Errors))
+	for _, detail := range results.ErrorDetails {
+		if isReportedError(detail.Error) {
+			fmt.Printf("  %d x %s (requests %s)\n", detail.Count, detail.Error, joinSeqs(detail.Requests, detail.Count))
+		}
+	}
+	if results.UnsampledErrors > 0 {
+		fmt.Printf("Unsampled Errors: %d failed requests had an error beyond the first %d distinct ones (TEST_MAX_ERROR_SAMPLES)\n", results.UnsampledErrors, cfg.MaxErrorSamples)
+	}
+	if len(results.ErrorRates) > 0 {
+		fmt.Printf("Error Rate Over Time (%s windows):\n", cfg.ErrorWindow)
+		for _, window := range results.ErrorRates {
+			fmt.Printf("%8.1fs  %6.2f%%  (%d/%d, %d timeouts)\n", window.Start, window.ErrorRate*100, window.Errors, window.Requests, window.Timeouts)
+		}
+	}
+	if len(results.RampProfile) > 0 {
+		fmt.Printf("Ramp Profile (%g/s bands):\n", cfg.RampBand)
+		for _, stage := range results.RampProfile {
+			band := fmt.Sprintf("%g-%g/s", stage.RateFrom, stage.RateTo)
+			fmt.Printf("%14s  achieved %.1f/s of %.1f/s over %.0fs  %6.2f%% errors  p50 %s  p99 %s\n",
+				band, stage.AchievedRate, stage.ConfiguredRate, stage.Seconds,
+				stage.ErrorRate*100, stage.Latencies.P50, stage.Latencies.P99)
+		}
+	}
 	fmt.Printf("\n\n\n")
-	//fmt.Printf("\n %+v", metrics)
+	//fmt.Printf("\n %+v", results)
+
+	if opts.repeat > 1 {
+		repeated := loadtest.Aggregate(runs)
+		fmt.Printf("===== Repeated %d Runs =====\n", len(runs))
+		fmt.Printf("The sections above show the last run\n")
+		fmt.Printf("         min / median / max\n")
+		for _, p := range []struct {
+			name   string
+			spread loadtest.PercentileSpread
+		}{{"50th", repeated.P50}, {"90th", repeated.P90}, {"95th", repeated.P95}, {"99th", repeated.P99}} {
+			fmt.Printf("%s: %s / %s / %s\n", p.name, p.spread.Min, p.spread.Median, p.spread.Max)
+		}
+		stability := "stable"
+		if !repeated.Stable {
+			stability = "UNSTABLE, compare runs with care"
+		}
+		fmt.Printf("99th spread: %.1f%% of the median (%s)\n", repeated.P99Spread*100, stability)
+		if opts.repeatOutput != "" {
+			if err := writeJSON(opts.repeatOutput, repeated); err != nil {
+				fmt.Println("Warning: writing -repeat-output failed:", err)
+			}
+		}
+		fmt.Printf("\n")
+	}
+
+	if results.BytesInCapped {
+		fmt.Printf("===== Aborted: Byte Cap Reached =====\n")
+		fmt.Printf("Responses added up to more than TEST_MAX_BYTES_IN (%d bytes), the test was stopped\n", cfg.MaxBytesIn)
+		fmt.Printf("The target may be streaming unexpectedly large responses, check Response Sizes\n\n")
+	} else if results.DeadlineExceeded {
+		fmt.Printf("===== Aborted: Deadline Exceeded =====\n")
+		fmt.Printf("The run passed -deadline %s and was stopped, results cover %s\n", cfg.Deadline, results.Duration)
+		if results.Abandoned > 0 {
+			fmt.Printf("%d requests were still in flight and are not included\n", results.Abandoned)
+		}
+		fmt.Printf("\n")
+	} else if results.Interrupted {
+		fmt.Printf("===== Interrupted =====\n")
+		fmt.Printf("Stopped before the end of the test, results cover %s\n", results.Duration)
+		if results.Abandoned > 0 {
+			fmt.Printf("%d requests were still in flight after %s and are not included\n", results.Abandoned, cfg.ShutdownTimeout)
+		}
+		fmt.Printf("\n")
+	}
+	if results.Paused > 0 {
+		fmt.Printf("===== Paused =====\n")
+		fmt.Printf("Paused for %s, which counts toward the duration and lowers the achieved rate\n", results.Paused.Round(time.Millisecond))
+		fmt.Printf("\n")
+	}
+	if results.GeneratorLimited {
+		fmt.Printf("===== Generator Limited =====\n")
+		fmt.Printf("Achieved rate %.2f/s is %.1f%% below the configured %.2f/s\n", results.Rate, results.RateDeficit*100, results.ConfiguredRate)
+		fmt.Printf("THIS machine or its network could not keep up, the results do not show the target's limit\n")
+		if cfg.RetryAfter && results.RateLimited > 0 {
+			fmt.Printf("Part of the deficit comes from pausing for Retry-After\n")
+		}
+		if results.Paused > 0 {
+			fmt.Printf("Part of the deficit comes from the %s paused\n", results.Paused.Round(time.Millisecond))
+		}
+		fmt.Printf("\n")
+	}
+	stats := results.GeneratorStats
+	fmt.Printf("===== Generator =====\n")
+	if stats.PeakRSS > 0 {
+		fmt.Printf("CPU Time:    %s (%.1f%% of %d CPUs)\n", stats.CPUTime.Round(time.Millisecond), stats.CPUUtilization*100, stats.CPUs)
+		fmt.Printf("Peak RSS:    %.1f MiB\n", float64(stats.PeakRSS)/(1<<20))
+	}
+	fmt.Printf("Go Memory:   %.1f MiB\n", float64(stats.GoMemory)/(1<<20))
+	fmt.Printf("\n")
+	if results.FileLimitErrors > 0 {
+		limit := "unknown"
+		if n, ok := loadtest.FileLimit(); ok {
+			limit = fmt.Sprint(n)
+		}
+		fmt.Printf("===== Generator Out Of File Descriptors =====\n")
+		fmt.Printf("%d requests failed with \"too many open files\" on THIS machine (limit: %s)\n", results.FileLimitErrors, limit)
+		fmt.Printf("These are not target errors. Raise the limit (ulimit -n), lower TEST_RATE or TEST_MAX_WORKERS,\n")
+		fmt.Printf("or set TEST_CAP_WORKERS_TO_FILE_LIMIT\n\n")
+	}
+
+	alertUploads.Wait()
+	if opts.webhook != "" {
+		if err := postWebhook(opts.webhook, opts.webhookHeader, results); err != nil {
+			if opts.uploadRequired {
+				fmt.Println("Upload failed:", err)
+				os.Exit(1)
+			}
+			fmt.Println("Warning: upload failed:", err)
+		}
+	}
+
+	if opts.statsd != "" {
+		if err := sendStatsd(opts.statsd, opts.statsdPrefix, results); err != nil {
+			fmt.Println("Warning: sending StatsD metrics failed:", err)
+		}
+	}
+
+	failures := cfg.Thresholds.Check(exact)
+	if opts.historyDir != "" {
+		regressions, err := compareHistory(opts.historyDir, opts.historyRuns, opts.historySigma, exact)
+		if err != nil {
+			fmt.Println("Warning: -history-dir:", err)
+		}
+		failures = append(failures, regressions...)
+	}
+	if results.DeadlineExceeded {
+		failures = append(failures, fmt.Sprintf("aborted after -deadline %s", cfg.Deadline))
+	}
+	if results.BytesInCapped {
+		failures = append(failures, fmt.Sprintf("aborted after receiving more than %d bytes (TEST_MAX_BYTES_IN)", cfg.MaxBytesIn))
+	}
+	if len(failures) > 0 {
+		fmt.Printf("===== Thresholds Failed =====\n")
+		for _, failure := range failures {
+			fmt.Println(failure)
+		}
+		if opts.precision >= 0 {
+			fmt.Printf("Thresholds are checked against the exact values shown here, the results are rounded to -precision %d\n", opts.precision)
+		}
+	}
+	if opts.markdownOutput != "" {
+		if err := writeMarkdown(opts.markdownOutput, renderMarkdown(cfg.AttackName(), results, opts.precision)); err != nil {
+			fmt.Println("Warning: writing -markdown-output failed:", err)
+		}
+	} else if opts.markdown {
+		fmt.Print(renderMarkdown(cfg.AttackName(), results, opts.precision))
+		fmt.Printf("\n")
+	}
+	if opts.jsonCompact {
+		line, err := json.Marshal(results)
+		if err != nil {
+			fmt.Println("Warning: encoding -json-compact failed:", err)
+		} else {
+			fmt.Println(string(line))
+		}
+	}
+	fmt.Println(results.Summary())
+	if len(failures) > 0 {
+		os.Exit(1)
+	}
+}
+
+// isReportedError is false for the 429 status, file limit and simulated errors
+// because they are reported on their own lines
+func isReportedError(e string) bool {
+	status := fmt.Sprintf("%d %s", http.StatusTooManyRequests, http.StatusText(http.StatusTooManyRequests))
+	return e != status && !loadtest.IsFileLimitError(e) && !loadtest.IsSimulatedError(e)
+}
+
+// reportedErrors removes the errors isReportedError leaves out
+func reportedErrors(errors []string) []string {
+	filtered := []string{}
+	for _, e := range errors {
+		if isReportedError(e) {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
+
+// joinSeqs lists request sequence numbers, ending with ... when count has more
+func joinSeqs(seqs []uint64, count uint64) string {
+	list := make([]string, len(seqs))
+	for i, seq := range seqs {
+		list[i] = strconv.FormatUint(seq, 10)
+	}
+	if count > uint64(len(seqs)) {
+		list = append(list, "...")
+	}
+	return strings.Join(list, ", ")
+}
+
+// seriesPeak returns the highest count of a per second series and its second,
+// false when every count is zero
+func seriesPeak(series []uint64) (uint64, int, bool) {
+	var peak uint64
+	at := 0
+	for second, count := range series {
+		if count > peak {
+			peak, at = count, second
+		}
+	}
+	return peak, at, peak > 0
+}
+
+// seriesSpan returns the first and last second with a non-zero count
+func seriesSpan(series []uint64) (int, int) {
+	first, last := -1, -1
+	for second, count := range series {
+		if count > 0 {
+			if first < 0 {
+				first = second
+			}
+			last = second
+		}
+	}
+	return first, last
+}
+
+// seriesRange returns the lowest and highest count of a per second series,
+// leaving out the last second which is usually partial
+func seriesRange(series []uint64) (uint64, uint64, bool) {
+	if len(series) < 2 {
+		return 0, 0, false
+	}
+	full := series[:len(series)-1]
+	return slices.Min(full), slices.Max(full), true
+}
+
+// tailReliability returns a suffix warning when there are too few samples for a tail percentile
+func tailReliability(samples uint64, needed uint64) string {
+	if samples < needed {
+		return fmt.Sprintf(" (unreliable, needs %d samples)", needed)
+	}
+	return ""
+}
+
+// formatRate prints v with precision decimal places, or six like %f when it is negative
+func formatRate(v float64, precision int) string {
+	if precision < 0 {
+		return fmt.Sprintf("%f", v)
+	}
+	return strconv.FormatFloat(v, 'f', precision, 64)
+}
 
+// printPhase prints one line of the latency breakdown
+func printPhase(name string, phase loadtest.PhaseLatency) {
+	fmt.Printf("%s: average %s, 50th %s, 99th %s, max %s (%d samples)\n", name, phase.Mean, phase.P50, phase.P99, phase.Max, phase.Samples)
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"code.ottojs.org/tests/load-testing/loadtest"
+)
+
+// markdownDecimals is the decimal places of -markdown numbers without -precision,
+// enough to compare runs without noise in every diff
+const markdownDecimals int = 2
+
+// renderMarkdown renders the results as GitHub-flavored Markdown tables for
+// pull requests and wikis. Every row is always present, in the same order,
+// so the tables of two runs diff line by line.
+func renderMarkdown(name string, results loadtest.Results, precision int) string {
+	if precision < 0 {
+		precision = markdownDecimals
+	}
+	number := func(v float64) string {
+		return fmt.Sprintf("%.*f", precision, v)
+	}
+	ms := func(d time.Duration) string {
+		return number(float64(d)/float64(time.Millisecond)) + " ms"
+	}
+	errorRate := 0.0
+	if results.Requests > 0 {
+		errorRate = float64(results.Failures) / float64(results.Requests)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "### %s\n\n", name)
+	fmt.Fprintf(&b, "| Metric | Value |\n")
+	fmt.Fprintf(&b, "| --- | ---: |\n")
+	rows := []struct{ metric, value string }{
+		{"Requests", fmt.Sprint(results.Requests)},
+		{"Duration", results.Duration.Round(time.Millisecond).String()},
+		{"Rate", number(results.Rate) + " /s"},
+		{"Throughput", number(results.Throughput) + " /s"},
+		{"Error rate", number(errorRate*100) + " %"},
+		{"Mean", ms(results.Latencies.Mean)},
+		{"p50", ms(results.Latencies.P50)},
+		{"p90", ms(results.Latencies.P90)},
+		{"p95", ms(results.Latencies.P95)},
+		{"p99", ms(results.Latencies.P99)},
+		{"p99.9", ms(results.Latencies.P999)},
+		{"Max", ms(results.Latencies.Max)},
+	}
+	for _, row := range rows {
+		fmt.Fprintf(&b, "| %s | %s |\n", row.metric, row.value)
+	}
+
+	codes := make([]string, 0, len(results.StatusCodes))
+	for code := range results.StatusCodes {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	fmt.Fprintf(&b, "\n| Status | Requests |\n")
+	fmt.Fprintf(&b, "| --- | ---: |\n")
+	for _, code := range codes {
+		label := code
+		if code == "0" {
+			// Vegeta's code for requests without a response
+			label = "0 (no response)"
+		}
+		fmt.Fprintf(&b, "| %s | %d |\n", label, results.StatusCodes[code])
+	}
+	return b.String()
+}
+
+// writeMarkdown writes the tables to a new file at path
+func writeMarkdown(path string, markdown string) error {
+	file, err := createOutputFile(path)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(markdown); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// pauseSignals returns nil, there is no SIGUSR1 or SIGUSR2 outside of unix
+func pauseSignals() <-chan bool {
+	return nil
+}
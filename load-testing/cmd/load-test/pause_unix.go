@@ -0,0 +1,28 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// pauseSignals returns a channel receiving true on SIGUSR1 (pause) and false on SIGUSR2 (resume)
+func pauseSignals() <-chan bool {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	pauses := make(chan bool)
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGUSR1 {
+				fmt.Println("Pausing, send SIGUSR2 to resume")
+			} else {
+				fmt.Println("Resuming")
+			}
+			pauses <- sig == syscall.SIGUSR1
+		}
+	}()
+	return pauses
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"code.ottojs.org/tests/load-testing/loadtest"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+// progressInterval is how often the progress line is redrawn
+const progressInterval time.Duration = 500 * time.Millisecond
+
+// isTerminal reports whether f is attached to a terminal rather than a file or pipe
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// progress draws a single updating line with the requests received so far,
+// the current rate, the failure percentage and the elapsed time
+type progress struct {
+	total    time.Duration
+	failed   func(*vegeta.Result) bool // Counts a result as a failure, like the results do
+	requests atomic.Uint64
+	failures atomic.Uint64
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+func newProgress(cfg loadtest.Config, total time.Duration) *progress {
+	return &progress{total: total, failed: cfg.Failed, done: make(chan struct{}), stopped: make(chan struct{})}
+}
+
+// wrap counts every result before passing it to next, which may be nil
+func (p *progress) wrap(next func(*vegeta.Result) error) func(*vegeta.Result) error {
+	return func(res *vegeta.Result) error {
+		p.requests.Add(1)
+		if p.failed(res) {
+			p.failures.Add(1)
+		}
+		if next == nil {
+			return nil
+		}
+		return next(res)
+	}
+}
+
+// start redraws the line until stop is called
+func (p *progress) start() {
+	began := time.Now()
+	ticker := time.NewTicker(progressInterval)
+	go func() {
+		defer close(p.stopped)
+		defer ticker.Stop()
+		var last uint64
+		lastAt := began
+		for {
+			select {
+			case <-p.done:
+				// Clear the line so the results start on a clean one
+				fmt.Print("\r\033[K")
+				return
+			case now := <-ticker.C:
+				requests := p.requests.Load()
+				rate := float64(requests-last) / now.Sub(lastAt).Seconds()
+				last, lastAt = requests, now
+				failureRate := 0.0
+				if requests > 0 {
+					failureRate = float64(p.failures.Load()) / float64(requests) * 100
+				}
+				elapsed := now.Sub(began).Round(time.Second)
+				fmt.Printf("\r\033[K%d requests  %.1f/s  %.2f%% failures  %s / %s", requests, rate, failureRate, elapsed, p.total)
+			}
+		}
+	}()
+}
+
+// stop clears the line and waits for the last redraw
+func (p *progress) stop() {
+	close(p.done)
+	<-p.stopped
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+)
+
+// resolveTimeout bounds the -check-dns lookup
+const resolveTimeout time.Duration = 5 * time.Second
+
+// checkResolves fails when the URI host is a name that does not resolve,
+// IP addresses are not looked up
+func checkResolves(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+	host := u.Hostname()
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+		return fmt.Errorf("host %s does not resolve: %w", host, err)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"time"
+)
+
+// selftestFlag starts the echo server instead of a load test.
+// It is handled before flag.Parse so it does not show up in -help.
+const selftestFlag string = "-selftest-server"
+
+// serveMockCommand starts the echo server like selftestFlag, with the
+// listen address as a flag, and is listed in -help
+const serveMockCommand string = "serve-mock"
+
+// selftestOptions shape the echo server's responses
+type selftestOptions struct {
+	latency     time.Duration
+	jitter      time.Duration
+	status      int
+	errorRate   float64
+	errorStatus int
+}
+
+// register adds the options to flags, their names starting with prefix
+func (o *selftestOptions) register(flags *flag.FlagSet, prefix string) {
+	flags.DurationVar(&o.latency, prefix+"latency", 0, "Delay before every response, override per request with ?latency=")
+	flags.DurationVar(&o.jitter, prefix+"jitter", 0, "Add a random delay between 0 and this to every response")
+	flags.IntVar(&o.status, prefix+"status", http.StatusOK, "Response status code, override per request with ?status=")
+	flags.Float64Var(&o.errorRate, prefix+"error-rate", 0, "Fraction of responses, between 0 and 1, failed on purpose with -"+prefix+"error-status")
+	flags.IntVar(&o.errorStatus, prefix+"error-status", http.StatusInternalServerError, "Status code of the -"+prefix+"error-rate responses")
+}
+
+func (o *selftestOptions) validate() error {
+	if o.latency < 0 || o.jitter < 0 {
+		return errors.New("latency and jitter must not be negative")
+	}
+	if o.errorRate < 0 || o.errorRate > 1 {
+		return fmt.Errorf("error rate must be between 0 and 1, got %g", o.errorRate)
+	}
+	for _, code := range []int{o.status, o.errorStatus} {
+		if code < 100 || code > 999 {
+			return fmt.Errorf("status codes must be between 100 and 999, got %d", code)
+		}
+	}
+	return nil
+}
+
+func (o *selftestOptions) String() string {
+	s := fmt.Sprintf("latency %s, status %d", o.latency, o.status)
+	if o.jitter > 0 {
+		s += fmt.Sprintf(", jitter %s", o.jitter)
+	}
+	if o.errorRate > 0 {
+		s += fmt.Sprintf(", %g%% of responses failed with %d", o.errorRate*100, o.errorStatus)
+	}
+	return s
+}
+
+// handler echoes the request body, or the request line when there is none
+func (o *selftestOptions) handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delay := o.latency
+		if value := r.URL.Query().Get("latency"); value != "" {
+			if d, err := time.ParseDuration(value); err == nil {
+				delay = d
+			}
+		}
+		if o.jitter > 0 {
+			delay += rand.N(o.jitter)
+		}
+		code := o.status
+		if value := r.URL.Query().Get("status"); value != "" {
+			if c, err := strconv.Atoi(value); err == nil && c >= 100 && c <= 999 {
+				code = c
+			}
+		}
+		time.Sleep(delay)
+
+		body, _ := io.ReadAll(r.Body)
+		if o.errorRate > 0 && rand.Float64() < o.errorRate {
+			w.WriteHeader(o.errorStatus)
+			w.Write([]byte("injected error\n"))
+			return
+		}
+		if len(body) == 0 {
+			body = []byte(r.Method + " " + r.RequestURI + "\n")
+		}
+		if contentType := r.Header.Get("Content-Type"); contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.WriteHeader(code)
+		w.Write(body)
+	})
+}
+
+// runSelftestServer starts a local echo server to point load tests at.
+// args are the arguments after -selftest-server, starting with the listen address.
+func runSelftestServer(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s :8080 [-latency 50ms] [-jitter 10ms] [-status 200] [-error-rate 0.01] [-error-status 500]", selftestFlag)
+	}
+	var options selftestOptions
+	flags := flag.NewFlagSet(selftestFlag, flag.ContinueOnError)
+	options.register(flags, "")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	return serveSelftest(args[0], &options)
+}
+
+// runServeMock starts the echo server for the serve-mock command,
+// args are the arguments after it
+func runServeMock(args []string) error {
+	var options selftestOptions
+	flags := flag.NewFlagSet(serveMockCommand, flag.ContinueOnError)
+	addr := flags.String("addr", ":8080", "Address to listen on")
+	options.register(flags, "")
+	if err := flags.Parse(args); errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+	return serveSelftest(*addr, &options)
+}
+
+func serveSelftest(addr string, options *selftestOptions) error {
+	if err := options.validate(); err != nil {
+		return err
+	}
+	fmt.Println("Self-test server listening on", addr, "with", options.String())
+	return http.ListenAndServe(addr, options.handler())
+}
+
+// startSelftestAttack starts the echo server in this process for -mock,
+// shaped by the -mock-* flags
+func startSelftestAttack(options *selftestOptions) (*httptest.Server, error) {
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	server := httptest.NewServer(options.handler())
+	fmt.Println("Self-test: attacking the echo server in this process at", server.URL, "with", options.String())
+	return server, nil
+}
+
+// usage prints the flags of a load test and the serve-mock command for -help
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags]\n", os.Args[0])
+	fmt.Fprintf(out, "       %s %s [-addr :8080] [-latency 50ms] [-jitter 10ms] [-status 200] [-error-rate 0.01] [-error-status 500]\n", os.Args[0], serveMockCommand)
+	fmt.Fprintf(out, "           Start the echo server to point TEST_URI at instead of running a load test\n\nFlags:\n")
+	flag.PrintDefaults()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.ottojs.org/tests/load-testing/loadtest"
+)
+
+// statsdPacketSize keeps packets under the usual 1500 byte MTU
+const statsdPacketSize int = 1400
+
+// validateStatsd checks the -statsd address is host:port with a numeric port
+func validateStatsd(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		return fmt.Errorf("missing host in %q", addr)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+// statsdMetrics formats the results as StatsD lines: latencies as timers in
+// milliseconds, requests, errors and status codes as counters, rates as gauges
+func statsdMetrics(prefix string, results loadtest.Results) []string {
+	ms := func(d time.Duration) string {
+		return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+	}
+	lines := []string{
+		prefix + ".latency.mean:" + ms(results.Latencies.Mean) + "|ms",
+		prefix + ".latency.min:" + ms(results.Latencies.Min) + "|ms",
+		prefix + ".latency.max:" + ms(results.Latencies.Max) + "|ms",
+		prefix + ".latency.p50:" + ms(results.Latencies.P50) + "|ms",
+		prefix + ".latency.p90:" + ms(results.Latencies.P90) + "|ms",
+		prefix + ".latency.p95:" + ms(results.Latencies.P95) + "|ms",
+		prefix + ".latency.p99:" + ms(results.Latencies.P99) + "|ms",
+		fmt.Sprintf("%s.requests:%d|c", prefix, results.Requests),
+		fmt.Sprintf("%s.errors:%d|c", prefix, results.Failures),
+		fmt.Sprintf("%s.rate:%f|g", prefix, results.Rate),
+		fmt.Sprintf("%s.throughput:%f|g", prefix, results.Throughput),
+	}
+	codes := make([]string, 0, len(results.StatusCodes))
+	for code := range results.StatusCodes {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		lines = append(lines, fmt.Sprintf("%s.status.%s:%d|c", prefix, code, results.StatusCodes[code]))
+	}
+	return lines
+}
+
+// sendStatsd sends the results over UDP, packing as many lines per packet as fit
+func sendStatsd(addr string, prefix string, results loadtest.Results) error {
+	conn, err := net.DialTimeout("udp", addr, webhookTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	packet := []string{}
+	size := 0
+	flush := func() error {
+		if len(packet) == 0 {
+			return nil
+		}
+		_, err := conn.Write([]byte(strings.Join(packet, "\n")))
+		packet, size = packet[:0], 0
+		return err
+	}
+	for _, line := range statsdMetrics(prefix, results) {
+		if size+len(line)+1 > statsdPacketSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		packet = append(packet, line)
+		size += len(line) + 1
+	}
+	return flush()
+}
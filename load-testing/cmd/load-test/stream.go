@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+// streamBuffer is the results queued per -stream-addr client,
+// a client further behind misses results instead of slowing the attack
+const streamBuffer int = 4096
+
+// streamWriteTimeout drops a client that stops reading
+const streamWriteTimeout time.Duration = 5 * time.Second
+
+// streamer publishes every result as a line of JSON to the clients connected
+// to -stream-addr, a TCP host:port or unix:/path/to.sock
+type streamer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	clients  map[chan []byte]struct{}
+	closed   bool
+	writers  sync.WaitGroup
+}
+
+func newStreamer(addr string) (*streamer, error) {
+	network := "tcp"
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		network, addr = "unix", path
+	}
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &streamer{listener: listener, clients: map[chan []byte]struct{}{}}
+	go s.accept()
+	return s, nil
+}
+
+func (s *streamer) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return // Closed
+		}
+		lines := make(chan []byte, streamBuffer)
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.clients[lines] = struct{}{}
+		s.writers.Add(1)
+		s.mu.Unlock()
+		go s.write(conn, lines)
+	}
+}
+
+// write sends the lines to one client until it disconnects or the stream closes
+func (s *streamer) write(conn net.Conn, lines chan []byte) {
+	defer s.writers.Done()
+	defer conn.Close()
+	for line := range lines {
+		conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if _, err := conn.Write(line); err != nil {
+			s.remove(lines)
+			// Drain so close does not wait on a channel nobody reads
+			for range lines {
+			}
+			return
+		}
+	}
+}
+
+func (s *streamer) remove(lines chan []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.clients[lines]; ok {
+		delete(s.clients, lines)
+		close(lines)
+	}
+}
+
+// wrap publishes every result before passing it to next, which may be nil
+func (s *streamer) wrap(next func(*vegeta.Result) error) func(*vegeta.Result) error {
+	return func(res *vegeta.Result) error {
+		s.publish(res)
+		if next == nil {
+			return nil
+		}
+		return next(res)
+	}
+}
+
+func (s *streamer) publish(res *vegeta.Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.clients) == 0 {
+		return
+	}
+	var line bytes.Buffer
+	if err := vegeta.NewJSONEncoder(&line).Encode(res); err != nil {
+		return
+	}
+	for lines := range s.clients {
+		select {
+		case lines <- line.Bytes():
+		default: // Client too far behind
+		}
+	}
+}
+
+// close stops accepting clients and waits for the queued results to be written
+func (s *streamer) close() {
+	s.listener.Close()
+	s.mu.Lock()
+	s.closed = true
+	for lines := range s.clients {
+		delete(s.clients, lines)
+		close(lines)
+	}
+	s.mu.Unlock()
+	s.writers.Wait()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// webhookTimeout bounds the upload so a slow receiver cannot hang the run
+const webhookTimeout time.Duration = 30 * time.Second
+
+// marshalJSON is the JSON serialization shared by every JSON output
+func marshalJSON(v any) ([]byte, error) {
+	return json.MarshalIndent(v, "", "\t")
+}
+
+// validateWebhook checks the webhook URL and the optional "Name: value" header
+func validateWebhook(webhook string, header string) error {
+	u, err := url.Parse(webhook)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https, got %q", u.Scheme)
+	}
+	if header != "" {
+		if name, _, ok := strings.Cut(header, ":"); !ok || strings.TrimSpace(name) == "" {
+			return errors.New(`header must look like "Name: value"`)
+		}
+	}
+	return nil
+}
+
+// postWebhook POSTs v, the results or an alert, as JSON to the webhook URL
+func postWebhook(webhook string, header string, v any) error {
+	body, err := marshalJSON(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if header != "" {
+		name, value, _ := strings.Cut(header, ":")
+		req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	client := &http.Client{Timeout: webhookTimeout}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %s", res.Status)
+	}
+	return nil
+}
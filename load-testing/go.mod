@@ -2,10 +2,12 @@ module code.ottojs.org/tests/load-testing
 
 go 1.22
 
-require github.com/tsenart/vegeta/v12 v12.11.3
+require (
+	github.com/influxdata/tdigest v0.0.1
+	github.com/tsenart/vegeta/v12 v12.11.3
+)
 
 require (
-	github.com/influxdata/tdigest v0.0.1 // indirect
 	github.com/josharian/intern v1.0.0 // indirect
 	github.com/mailru/easyjson v0.7.7 // indirect
 	github.com/rs/dnscache v0.0.0-20230804202142-fc85eb664529 // indirect
@@ -0,0 +1,358 @@
+package loadtest
+
+import (
+	"maps"
+	"mime"
+	"net/http"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/influxdata/tdigest"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+// accumulator collects the results of an attack as they arrive.
+// vegeta.Metrics does the heavy lifting, the counters add what it does not track.
+type accumulator struct {
+	cfg     Config
+	began   time.Time
+	metrics vegeta.Metrics
+
+	failures              uint64
+	rateLimited           uint64
+	rateLimiting          RateLimitingResults
+	fileLimitErrors       uint64
+	simulatedErrors       uint64
+	timeouts              uint64
+	softTimeouts          uint64 // Timeouts not counted as failures, see Config.SoftTimeout
+	fuzz                  FuzzResults
+	successes             uint64 // Status 2xx and 3xx like vegeta.Metrics.Success
+	contentTypeMismatches uint64
+	emptyBodies           uint64
+	errorWindows          []ErrorRateWindow
+	errorDetails          []ErrorDetail
+	errorIndex            map[string]int // Index in errorDetails
+	unsampledErrors       uint64
+	throughputSeries      []uint64
+	timeoutSeries         []uint64 // Same seconds as throughputSeries
+	seriesSeconds         int      // Seconds of throughputSeries with requests so far
+	responseSizes         responseSizes
+
+	// Compiled from the config, nil when not set
+	successBody   *regexp.Regexp
+	failureBody   *regexp.Regexp
+	bodySuccesses uint64
+}
+
+// newAccumulator expects a validated config
+func newAccumulator(cfg Config, began time.Time) *accumulator {
+	a := &accumulator{cfg: cfg, began: began, responseSizes: newResponseSizes()}
+	// One count per second of the attack, so memory is bounded by Duration
+	a.throughputSeries = make([]uint64, int((cfg.Duration+time.Second-1)/time.Second))
+	a.timeoutSeries = make([]uint64, len(a.throughputSeries))
+	if cfg.SuccessBodyRegex != "" {
+		a.successBody = regexp.MustCompile(cfg.SuccessBodyRegex)
+	}
+	if cfg.FailureBodyRegex != "" {
+		a.failureBody = regexp.MustCompile(cfg.FailureBodyRegex)
+	}
+	return a
+}
+
+func (a *accumulator) add(res *vegeta.Result) {
+	soft := a.cfg.softTimeout(res)
+	rejected := a.cfg.fuzzRejected(res)
+	if res.Error != "" && !soft && !rejected {
+		a.addErrorSample(res)
+	}
+	if res.Error != "" && (a.cfg.MaxErrorSamples > 0 || soft || rejected) {
+		// vegeta.Metrics keeps every distinct error, keep a capped sample instead.
+		// Soft timeouts and rejected fuzz requests are left out of the errors altogether.
+		// Success only depends on the status code, so it is not affected.
+		stripped := *res
+		stripped.Error = ""
+		a.metrics.Add(&stripped)
+	} else {
+		a.metrics.Add(res)
+	}
+	a.responseSizes.add(res.BytesIn)
+	if res.Code >= 200 && res.Code < 400 {
+		a.successes++
+	}
+	if isFuzzed(res) {
+		a.addFuzzed(res, rejected)
+	}
+	if soft {
+		a.timeouts++
+		a.softTimeouts++
+	} else if rejected {
+		// An expected outcome, like a success
+		a.successes++
+	} else if res.Error != "" {
+		a.failures++
+		if IsFileLimitError(res.Error) {
+			a.fileLimitErrors++
+		}
+		if IsSimulatedError(res.Error) {
+			a.simulatedErrors++
+		}
+		if IsTimeoutError(res.Error) {
+			a.timeouts++
+		}
+	}
+	if res.Code == http.StatusTooManyRequests {
+		a.rateLimited++
+		a.addRateLimited(res)
+	}
+	if res.Error == "" && res.Code >= 200 && res.Code < 300 && res.BytesIn == 0 && a.cfg.expectsBody() {
+		a.emptyBodies++
+	}
+	if a.cfg.ErrorWindow > 0 {
+		a.addErrorWindow(res)
+	}
+	if len(a.throughputSeries) > 0 {
+		second := max(0, min(int(res.Timestamp.Sub(a.began)/time.Second), len(a.throughputSeries)-1))
+		a.throughputSeries[second]++
+		if res.Error != "" && IsTimeoutError(res.Error) {
+			a.timeoutSeries[second]++
+		}
+		a.seriesSeconds = max(a.seriesSeconds, second+1)
+	}
+	if a.cfg.checksBody() && res.Error == "" && a.bodySucceeded(res.Body) {
+		a.bodySuccesses++
+	}
+	if a.cfg.ExpectContentType != "" && a.cfg.expectsBody() && res.Code != 0 && !matchesMediaType(res.Headers.Get("Content-Type"), a.cfg.ExpectContentType) {
+		a.contentTypeMismatches++
+	}
+}
+
+func (a *accumulator) results() Results {
+	a.metrics.Close()
+	results := newResults(&a.metrics)
+	results.Failures = a.failures
+	results.RateLimited = a.rateLimited
+	results.RateLimiting = a.rateLimiting
+	if results.RateLimiting.RetryAfter == nil {
+		results.RateLimiting.RetryAfter = []string{}
+	}
+	results.FileLimitErrors = a.fileLimitErrors
+	results.SimulatedErrors = a.simulatedErrors
+	results.Timeouts = a.timeouts
+	if a.cfg.Fuzz.isSet() {
+		fuzz := a.fuzz
+		fuzz.Mode, fuzz.Rate = a.cfg.Fuzz.Mode, a.cfg.Fuzz.Rate
+		results.Fuzz = &fuzz
+		// Rejections are errors to Vegeta
+		results.Success = float64(a.successes) / float64(max(1, results.Requests))
+	}
+	if a.cfg.SoftTimeout {
+		// Soft timeouts count as neither a success nor a failure
+		results.SoftTimeouts = true
+		results.Success = 0
+		if completed := results.Requests - a.softTimeouts; completed > 0 {
+			results.Success = float64(a.successes) / float64(completed)
+		}
+		if a.softTimeouts > 0 {
+			results.StatusCodes = maps.Clone(results.StatusCodes)
+			if results.StatusCodes["0"] -= int(a.softTimeouts); results.StatusCodes["0"] <= 0 {
+				delete(results.StatusCodes, "0")
+			}
+		}
+	}
+	results.ContentTypeMismatches = a.contentTypeMismatches
+	results.EmptyBodies = a.emptyBodies
+	results.ResponseSizes = a.responseSizes.results()
+	if a.cfg.checksBody() {
+		results.BodyChecked = true
+		results.BodyFailures = results.Requests - a.bodySuccesses
+		if results.Requests > 0 {
+			results.BodySuccess = float64(a.bodySuccesses) / float64(results.Requests)
+		}
+	}
+	for i := range a.errorWindows {
+		if window := &a.errorWindows[i]; window.Requests > 0 {
+			window.ErrorRate = float64(window.Errors) / float64(window.Requests)
+		}
+	}
+	results.ErrorRates = a.errorWindows
+	results.ErrorDetails = make([]ErrorDetail, len(a.errorDetails))
+	for i, detail := range a.errorDetails {
+		detail.Requests = slices.Clone(detail.Requests)
+		results.ErrorDetails[i] = detail
+	}
+	if a.cfg.MaxErrorSamples > 0 {
+		results.Errors = make([]string, len(a.errorDetails))
+		for i, detail := range a.errorDetails {
+			results.Errors[i] = detail.Error
+		}
+		results.UnsampledErrors = a.unsampledErrors
+	}
+	// Interrupted attacks and snapshots end early, leave out the seconds after
+	results.ThroughputSeries = a.throughputSeries[:a.seriesSeconds]
+	results.TimeoutSeries = a.timeoutSeries[:a.seriesSeconds]
+	results.Latencies.Reliable = results.Latencies.Samples >= a.cfg.minSamples()
+	results.Latencies.unit = a.cfg.LatencyUnit
+	if a.cfg.LatenciesMs {
+		ms := results.Latencies.Milliseconds()
+		results.LatenciesMs = &ms
+	}
+	results.ConfiguredRate = a.cfg.RatePerSecond()
+	if deficit := 1 - results.Rate/results.ConfiguredRate; deficit > 0 {
+		results.RateDeficit = deficit
+		results.GeneratorLimited = deficit > a.cfg.rateTolerance()
+	}
+	return results
+}
+
+// softTimeout reports whether res timed out with Config.SoftTimeout set
+func (c Config) softTimeout(res *vegeta.Result) bool {
+	return c.SoftTimeout && res.Error != "" && IsTimeoutError(res.Error)
+}
+
+// fuzzRejected reports whether res is a 4xx response to a Config.Fuzz request,
+// the target rejecting it as it should. 429 is a rate limit, not a rejection.
+func (c Config) fuzzRejected(res *vegeta.Result) bool {
+	return res.Code >= 400 && res.Code < 500 && res.Code != http.StatusTooManyRequests && isFuzzed(res)
+}
+
+// Failed reports whether res counts toward Results.Failures, which soft
+// timeouts and rejected fuzz requests do not although they have an error
+func (c Config) Failed(res *vegeta.Result) bool {
+	return res.Error != "" && !c.softTimeout(res) && !c.fuzzRejected(res)
+}
+
+// addFuzzed counts the outcome of a Config.Fuzz request
+func (a *accumulator) addFuzzed(res *vegeta.Result, rejected bool) {
+	a.fuzz.Requests++
+	switch {
+	case rejected:
+		a.fuzz.Rejected++
+	case res.Error == "" && res.Code >= 200 && res.Code < 400:
+		a.fuzz.Accepted++
+	default:
+		a.fuzz.Failed++
+	}
+}
+
+// bodySucceeded applies the body regexes to the start of the body
+func (a *accumulator) bodySucceeded(body []byte) bool {
+	if len(body) > MaxBodyMatchBytes {
+		body = body[:MaxBodyMatchBytes]
+	}
+	if a.successBody != nil && !a.successBody.Match(body) {
+		return false
+	}
+	if a.failureBody != nil && a.failureBody.Match(body) {
+		return false
+	}
+	return true
+}
+
+// addErrorSample keeps the first Config.MaxErrorSamples distinct errors
+// with the requests that failed with them, counting the requests whose error did not fit
+func (a *accumulator) addErrorSample(res *vegeta.Result) {
+	index, ok := a.errorIndex[res.Error]
+	if !ok {
+		if a.cfg.MaxErrorSamples > 0 && len(a.errorDetails) >= a.cfg.MaxErrorSamples {
+			a.unsampledErrors++
+			return
+		}
+		if a.errorIndex == nil {
+			a.errorIndex = map[string]int{}
+		}
+		index = len(a.errorDetails)
+		a.errorIndex[res.Error] = index
+		a.errorDetails = append(a.errorDetails, ErrorDetail{Error: res.Error})
+	}
+	detail := &a.errorDetails[index]
+	detail.Count++
+	if len(detail.Requests) < MaxErrorDetailRequests {
+		detail.Requests = append(detail.Requests, res.Seq)
+	}
+}
+
+// addRateLimited records when the first 429 was sent and samples Retry-After
+func (a *accumulator) addRateLimited(res *vegeta.Result) {
+	at := res.Timestamp.Sub(a.began).Seconds()
+	if a.rateLimiting.FirstAt == 0 || at < a.rateLimiting.FirstAt {
+		a.rateLimiting.FirstAt = at
+	}
+	value := res.Headers.Get("Retry-After")
+	if value == "" {
+		return
+	}
+	a.rateLimiting.WithRetryAfter++
+	if len(a.rateLimiting.RetryAfter) < MaxRetryAfterSamples && !slices.Contains(a.rateLimiting.RetryAfter, value) {
+		a.rateLimiting.RetryAfter = append(a.rateLimiting.RetryAfter, value)
+	}
+}
+
+// addErrorWindow counts the result in the window its request was sent in
+func (a *accumulator) addErrorWindow(res *vegeta.Result) {
+	index := int(res.Timestamp.Sub(a.began) / a.cfg.ErrorWindow)
+	if index < 0 {
+		index = 0
+	}
+	for len(a.errorWindows) <= index {
+		start := time.Duration(len(a.errorWindows)) * a.cfg.ErrorWindow
+		a.errorWindows = append(a.errorWindows, ErrorRateWindow{Start: start.Seconds()})
+	}
+	a.errorWindows[index].Requests++
+	if res.Error != "" {
+		if a.cfg.Failed(res) {
+			a.errorWindows[index].Errors++
+		}
+		if IsTimeoutError(res.Error) {
+			a.errorWindows[index].Timeouts++
+		}
+	}
+}
+
+// responseSizes tracks body sizes in a t-digest like vegeta.Metrics does for latencies,
+// so memory stays bounded on long runs
+type responseSizes struct {
+	count    uint64
+	total    uint64
+	min, max uint64
+	digest   *tdigest.TDigest
+}
+
+func newResponseSizes() responseSizes {
+	return responseSizes{digest: tdigest.NewWithCompression(100)}
+}
+
+func (s *responseSizes) add(size uint64) {
+	if s.count == 0 || size < s.min {
+		s.min = size
+	}
+	if size > s.max {
+		s.max = size
+	}
+	s.count++
+	s.total += size
+	s.digest.Add(float64(size), 1)
+}
+
+func (s *responseSizes) results() ResponseSizeResults {
+	if s.count == 0 {
+		return ResponseSizeResults{}
+	}
+	return ResponseSizeResults{
+		Min:  s.min,
+		Mean: float64(s.total) / float64(s.count),
+		P50:  uint64(s.digest.Quantile(0.50)),
+		P99:  uint64(s.digest.Quantile(0.99)),
+		Max:  s.max,
+	}
+}
+
+// matchesMediaType compares the media type of a Content-Type header,
+// ignoring parameters like charset and case
+func matchesMediaType(header string, expected string) bool {
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return false
+	}
+	return mediaType == expected
+}
@@ -0,0 +1,150 @@
+package loadtest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+// retainedHeap returns the live heap after a collection, so what the
+// benchmarked loop keeps is the difference between two calls
+func retainedHeap() uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+// BenchmarkMetricsAdd is the loop before the accumulator: every result added to
+// vegeta.Metrics, which keeps every distinct error message
+func BenchmarkMetricsAdd(b *testing.B) {
+	began := time.Now()
+	before := retainedHeap()
+	var metrics vegeta.Metrics
+	for i := range b.N {
+		res := benchmarkResult(i, began)
+		metrics.Add(&res)
+	}
+	metrics.Close()
+	b.StopTimer()
+	b.ReportMetric(float64(retainedHeap()-before)/float64(b.N), "retained-B/op")
+	runtime.KeepAlive(&metrics)
+}
+
+// BenchmarkAccumulator feeds the same results to the accumulator RunContext uses,
+// which keeps at most MaxErrorSamples messages. Compare retained-B/op with
+// BenchmarkMetricsAdd: it stays flat here while it grows with the errors there.
+func BenchmarkAccumulator(b *testing.B) {
+	began := time.Now()
+	cfg := Config{
+		URI:             "http://localhost/",
+		Rate:            benchmarkRate,
+		Duration:        time.Duration(b.N)*time.Second/benchmarkRate + time.Second,
+		Timeout:         5 * time.Second,
+		MaxErrorSamples: 100,
+	}
+	before := retainedHeap()
+	acc := newAccumulator(cfg, began)
+	for i := range b.N {
+		res := benchmarkResult(i, began)
+		acc.add(&res)
+	}
+	acc.results()
+	b.StopTimer()
+	b.ReportMetric(float64(retainedHeap()-before)/float64(b.N), "retained-B/op")
+	runtime.KeepAlive(acc)
+}
+
+func TestEmptyBodies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("empty") == "" {
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+
+	for _, test := range []struct {
+		name  string
+		query string
+		empty bool
+	}{
+		{"empty 200s", "?empty=1", true},
+		{"200s with a body", "", false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := Config{URI: server.URL + "/" + test.query, Rate: 50, Duration: time.Second, Timeout: 5 * time.Second}
+			results, err := RunContext(context.Background(), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if results.Requests == 0 {
+				t.Fatal("no requests sent")
+			}
+			// Empty bodies are a soft failure of their own, not an error
+			if results.Failures != 0 || results.Success != 1 || len(results.Errors) != 0 {
+				t.Errorf("failures %d, success %g, errors %v, want none", results.Failures, results.Success, results.Errors)
+			}
+			wantEmpty := uint64(0)
+			if test.empty {
+				wantEmpty = results.Requests
+			}
+			if results.EmptyBodies != wantEmpty {
+				t.Errorf("empty bodies %d, want %d", results.EmptyBodies, wantEmpty)
+			}
+			failures := Thresholds{FailOnEmptyBody: true}.Check(results)
+			if failed := len(failures) > 0; failed != test.empty {
+				t.Errorf("FailOnEmptyBody failures %v, want failed %t", failures, test.empty)
+			}
+		})
+	}
+}
+
+func TestBodilessMethods(t *testing.T) {
+	for _, test := range []struct {
+		method    string
+		checkBody bool
+	}{
+		{http.MethodHead, false},
+		{http.MethodOptions, false},
+		{http.MethodGet, true},
+	} {
+		t.Run(test.method, func(t *testing.T) {
+			cfg := Config{
+				URI:               "http://localhost/",
+				Method:            test.method,
+				Rate:              1,
+				Duration:          time.Second,
+				Timeout:           time.Second,
+				SuccessBodyRegex:  `"data"`,
+				ExpectContentType: "application/json",
+			}
+			began := time.Now()
+			acc := newAccumulator(cfg, began)
+			acc.add(&vegeta.Result{Method: test.method, Code: http.StatusOK, Timestamp: began, Latency: time.Millisecond, Headers: http.Header{}})
+			results := acc.results()
+
+			// A bodiless 2xx is a success for every method
+			if results.Success != 1 || results.Failures != 0 || results.BytesIn != 0 {
+				t.Errorf("success %g, failures %d, bytes in %d, want 1, 0, 0", results.Success, results.Failures, results.BytesIn)
+			}
+			want := uint64(0)
+			if test.checkBody {
+				want = 1
+			}
+			if results.EmptyBodies != want {
+				t.Errorf("empty bodies %d, want %d", results.EmptyBodies, want)
+			}
+			if results.BodyChecked != test.checkBody || results.BodyFailures != want {
+				t.Errorf("body checked %t with %d failures, want %t with %d", results.BodyChecked, results.BodyFailures, test.checkBody, want)
+			}
+			if results.ContentTypeMismatches != want {
+				t.Errorf("content type mismatches %d, want %d", results.ContentTypeMismatches, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package loadtest
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/influxdata/tdigest"
+)
+
+// DefaultAlertWindow is used when LiveAlertConfig.Window is zero
+const DefaultAlertWindow time.Duration = 30 * time.Second
+
+// LiveAlertConfig calls Config.OnAlert during the attack when the p99 latency
+// of the requests sent in the last Window goes above P99, for early warning in
+// long runs. Zero P99 disables the alert.
+type LiveAlertConfig struct {
+	P99      time.Duration // Threshold
+	Window   time.Duration // Rolling window the p99 is computed over, 0 uses DefaultAlertWindow
+	Cooldown time.Duration // Minimum time between alerts, 0 uses the window
+}
+
+func (l LiveAlertConfig) validate() error {
+	if l.P99 < 0 {
+		return fmt.Errorf("alert p99 must not be negative, got %s", l.P99)
+	}
+	if l.Window != 0 && l.Window < time.Second {
+		return fmt.Errorf("alert window must be at least 1s, got %s", l.Window)
+	}
+	if l.Cooldown < 0 {
+		return fmt.Errorf("alert cooldown must not be negative, got %s", l.Cooldown)
+	}
+	return nil
+}
+
+func (l LiveAlertConfig) isSet() bool {
+	return l.P99 > 0
+}
+
+func (l LiveAlertConfig) window() time.Duration {
+	if l.Window == 0 {
+		return DefaultAlertWindow
+	}
+	return l.Window
+}
+
+func (l LiveAlertConfig) cooldown() time.Duration {
+	if l.Cooldown == 0 {
+		return l.window()
+	}
+	return l.Cooldown
+}
+
+// Alert is passed to Config.OnAlert when the rolling p99 crossed the threshold
+type Alert struct {
+	At        time.Duration `json:"at"` // Since the attack began
+	P99       time.Duration `json:"p99"`
+	Threshold time.Duration `json:"threshold"`
+	Window    time.Duration `json:"window"`
+	Requests  uint64        `json:"requests"` // Requests in the window
+}
+
+// alerter keeps one latency digest per second of the window
+type alerter struct {
+	cfg     LiveAlertConfig
+	began   time.Time
+	seconds []*tdigest.TDigest
+	counts  []uint64
+	current int64 // Second since began of the newest bucket
+	fired   time.Time
+}
+
+func newAlerter(cfg LiveAlertConfig, began time.Time) *alerter {
+	size := int(cfg.window() / time.Second)
+	a := &alerter{cfg: cfg, began: began, seconds: make([]*tdigest.TDigest, size), counts: make([]uint64, size)}
+	for i := range a.seconds {
+		a.seconds[i] = tdigest.NewWithCompression(100)
+	}
+	return a
+}
+
+// advance clears the buckets of the seconds that left the window
+func (a *alerter) advance(second int64) {
+	for ; a.current < second; a.current++ {
+		i := (a.current + 1) % int64(len(a.seconds))
+		a.seconds[i].Reset()
+		a.counts[i] = 0
+	}
+}
+
+func (a *alerter) add(timestamp time.Time, latency time.Duration) {
+	second := int64(timestamp.Sub(a.began) / time.Second)
+	if second <= a.current-int64(len(a.seconds)) {
+		return // Sent before the window, the response was slow
+	}
+	a.advance(second)
+	i := second % int64(len(a.seconds))
+	a.seconds[i].Add(float64(latency), 1)
+	a.counts[i]++
+}
+
+// check returns an alert when the window's p99 is above the threshold
+// and the last alert is older than the cooldown
+func (a *alerter) check(now time.Time) (Alert, bool) {
+	a.advance(int64(now.Sub(a.began) / time.Second))
+	if !a.fired.IsZero() && now.Sub(a.fired) < a.cfg.cooldown() {
+		return Alert{}, false
+	}
+	merged := tdigest.NewWithCompression(100)
+	var requests uint64
+	for i, digest := range a.seconds {
+		merged.AddCentroidList(digest.Centroids())
+		requests += a.counts[i]
+	}
+	if requests == 0 {
+		return Alert{}, false
+	}
+	p99 := time.Duration(merged.Quantile(0.99))
+	if p99 <= a.cfg.P99 {
+		return Alert{}, false
+	}
+	a.fired = now
+	return Alert{At: now.Sub(a.began), P99: p99, Threshold: a.cfg.P99, Window: a.cfg.window(), Requests: requests}, true
+}
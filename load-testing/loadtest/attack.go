@@ -0,0 +1,387 @@
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+// AttackName is the default Config.Name
+const AttackName string = "Load Test"
+
+// NewTargeter returns a targeter hitting the configured URI on every request,
+// taking turns through Config.BodyPool and Config.ChaosHeader values when they are set.
+// With Config.BodyWeights the bodies are expanded into a table by weight, spread out
+// like smooth weighted round-robin, so the order only depends on the config:
+// weights 5, 1, 1 send a a b a c a a, then repeat. With Config.BodyPoolRandom a body
+// is picked from that table at random instead. Config.Replay replaces all of that.
+// Config.Fuzz then malforms some of the bodies.
+func NewTargeter(cfg Config) vegeta.Targeter {
+	var targeter vegeta.Targeter
+	if len(cfg.Replay) > 0 {
+		targeter = replayTargeter(cfg)
+	} else if len(cfg.BodyPool) == 0 {
+		targeter = vegeta.NewStaticTargeter(vegeta.Target{
+			Method: cfg.method(),
+			URL:    cfg.URI,
+			Body:   cfg.Body,
+			Header: cfg.header(),
+		})
+	} else {
+		order := weightedOrder(cfg.BodyWeights)
+		if order == nil {
+			order = make([]int, len(cfg.BodyPool))
+			for i := range order {
+				order[i] = i
+			}
+		}
+		header := cfg.header()
+		targets := make([]vegeta.Target, len(order))
+		for i, body := range order {
+			targets[i] = vegeta.Target{Method: cfg.method(), URL: cfg.URI, Body: cfg.BodyPool[body], Header: header}
+		}
+		if cfg.BodyPoolRandom {
+			targeter = randomTargeter(targets)
+		} else {
+			targeter = vegeta.NewStaticTargeter(targets...)
+		}
+	}
+	if cfg.ChaosHeader.isSet() {
+		targeter = chaosTargeter(targeter, cfg.ChaosHeader)
+	}
+	if cfg.Fuzz.isSet() {
+		targeter = fuzzTargeter(targeter, cfg.Fuzz)
+	}
+	return targeter
+}
+
+// NewPacer returns a constant rate pacer for the configured rate,
+// or one following Config.Replay or Config.RateSchedule when it is set
+func NewPacer(cfg Config) vegeta.Pacer {
+	if len(cfg.Replay) > 0 {
+		return newReplayPacer(cfg.Replay)
+	}
+	if len(cfg.RateSchedule) > 0 {
+		return newSchedulePacer(cfg.RateSchedule, cfg.RateScheduleLoop, cfg.Duration)
+	}
+	return vegeta.Rate{
+		Freq: cfg.Rate,
+		Per:  cfg.ratePer(),
+	}
+}
+
+// NewAttacker returns an HTTP/1.1 attacker that does not follow redirects.
+// Without KeepAlive every request opens a fresh connection.
+// Config.MeasureTLSHandshake, MeasureLatencyBreakdown and MeasureConnWait only have an effect through Run.
+func NewAttacker(cfg Config) *vegeta.Attacker {
+	return newAttacker(cfg, newHandshakeRecorder(), newPhaseRecorder(), newConnWaitRecorder())
+}
+
+func newAttacker(cfg Config, handshakes *handshakeRecorder, phases *phaseRecorder, connWaits *connWaitRecorder) *vegeta.Attacker {
+	attacker := vegeta.NewAttacker()
+	vegeta.KeepAlive(cfg.KeepAlive)(attacker)
+	vegeta.Connections(cfg.maxIdleConnsPerHost())(attacker)
+	vegeta.HTTP2(false)(attacker)
+	vegeta.Redirects(0)(attacker)
+	vegeta.Timeout(cfg.Timeout)(attacker)
+	if cfg.TLS.isSet() {
+		vegeta.TLSConfig(cfg.TLS.clientConfig())(attacker)
+	}
+	if cfg.Workers > 0 {
+		vegeta.Workers(cfg.Workers)(attacker)
+	}
+	if maxWorkers := cfg.EffectiveMaxWorkers(); maxWorkers > 0 {
+		vegeta.MaxWorkers(maxWorkers)(attacker)
+	}
+	if cfg.RawURL || cfg.NetworkSim.isSet() || cfg.MeasureTLSHandshake || cfg.MeasureLatencyBreakdown ||
+		cfg.ReadBufferSize > 0 || cfg.WriteBufferSize > 0 || cfg.IPVersion != "" || cfg.DisableTCPNoDelay || cfg.BodyFile != "" ||
+		cfg.MaxConnsPerHost > 0 || cfg.MaxTotalConns > 0 || cfg.MeasureConnWait {
+		vegeta.Client(newClient(cfg, handshakes, phases, connWaits))(attacker)
+	}
+	return attacker
+}
+
+// Run validates the config, attacks the target and returns the results
+func Run(cfg Config) (Results, error) {
+	return RunContext(context.Background(), cfg)
+}
+
+// RunContext is Run, stopping the attack early when ctx is cancelled.
+// Requests in flight are waited for up to cfg.ShutdownTimeout,
+// the ones still running after that are counted as abandoned.
+func RunContext(ctx context.Context, cfg Config) (Results, error) {
+	if err := cfg.Validate(); err != nil {
+		return Results{}, err
+	}
+
+	var sent atomic.Uint64
+	targeter := countingTargeter(NewTargeter(cfg), &sent)
+	pacer := NewPacer(cfg)
+	schedule, _ := pacer.(*schedulePacer)
+	handshakes := newHandshakeRecorder()
+	phases := newPhaseRecorder()
+	connWaits := newConnWaitRecorder()
+	attacker := newAttacker(cfg, handshakes, phases, connWaits)
+
+	var backoff *backoffPacer
+	var end <-chan time.Time
+	if cfg.RetryAfter || cfg.Pauses != nil {
+		backoff = &backoffPacer{pacer: pacer}
+		pacer = backoff
+	}
+	// stopPacers releases the pacers that block, Vegeta cannot stop the attack while they do
+	stopPacers := func() {
+		if backoff != nil {
+			backoff.stop()
+		}
+		if schedule != nil {
+			schedule.stop()
+		}
+	}
+	if cfg.Pauses != nil {
+		timer := time.NewTimer(cfg.Duration)
+		defer timer.Stop()
+		end = timer.C
+	}
+
+	// Vegeta counts the bytes of Target.Body, which is empty with a BodyFile
+	var bodyFileSize int64
+	if cfg.BodyFile != "" {
+		file, size, err := openBodyFile(cfg.BodyFile)
+		if err != nil {
+			return Results{}, fmt.Errorf("invalid body file: %w", err)
+		}
+		file.Close()
+		bodyFileSize = size
+	}
+
+	usage := startUsage()
+	began := time.Now()
+	acc := newAccumulator(cfg, began)
+	var snapshot *accumulator
+	var snapshots <-chan time.Time
+	if cfg.SnapshotInterval > 0 && cfg.OnSnapshot != nil {
+		snapshot = newAccumulator(cfg, began)
+		ticker := time.NewTicker(cfg.SnapshotInterval)
+		defer ticker.Stop()
+		snapshots = ticker.C
+	}
+	var ramp *rampProfile
+	if cfg.RampBand > 0 {
+		ramp = newRampProfile(cfg, began)
+	}
+	var alerts *alerter
+	var alertChecks <-chan time.Time
+	if cfg.LiveAlert.isSet() && cfg.OnAlert != nil {
+		alerts = newAlerter(cfg.LiveAlert, began)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		alertChecks = ticker.C
+	}
+	var resultErr error
+	var received uint64
+	var bytesIn uint64
+	var bytesInCapped bool
+	var excluded uint64
+	var interrupted bool
+	var abandoned uint64
+	var shutdown <-chan time.Time
+	var deadline <-chan time.Time
+	var deadlineExceeded bool
+	if cfg.Deadline > 0 {
+		timer := time.NewTimer(cfg.Deadline)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	done := ctx.Done()
+	attack := attacker.Attack(targeter, pacer, cfg.Duration, cfg.AttackName())
+	if cfg.ResultBuffer > 0 {
+		attack = bufferResults(attack, cfg.ResultBuffer)
+	}
+loop:
+	for {
+		select {
+		case res, ok := <-attack:
+			if !ok {
+				break loop
+			}
+			received++
+			if bodyFileSize > 0 && res.Code != 0 {
+				res.BytesOut = uint64(bodyFileSize)
+			}
+			bytesIn += res.BytesIn
+			if cfg.MaxBytesIn > 0 && bytesIn > uint64(cfg.MaxBytesIn) && !bytesInCapped {
+				bytesInCapped = true
+				stopPacers()
+				attacker.Stop()
+			}
+			if res.Timestamp.Sub(began) < cfg.ExcludeFirst {
+				excluded++
+			} else {
+				acc.add(res)
+				if snapshot != nil {
+					snapshot.add(res)
+				}
+				if ramp != nil {
+					ramp.add(res)
+				}
+				if alerts != nil {
+					alerts.add(res.Timestamp, res.Latency)
+				}
+			}
+			if cfg.RetryAfter && res.Code == http.StatusTooManyRequests {
+				backoff.pause(retryAfter(res.Headers, cfg.Duration))
+			}
+			if cfg.OnResult != nil && resultErr == nil {
+				if resultErr = cfg.OnResult(res); resultErr != nil {
+					stopPacers()
+					attacker.Stop()
+				}
+			}
+		case now := <-snapshots:
+			if resultErr == nil {
+				if err := cfg.OnSnapshot(snapshot.results()); err != nil {
+					resultErr = fmt.Errorf("snapshot: %w", err)
+					stopPacers()
+					attacker.Stop()
+				}
+			}
+			snapshot = newAccumulator(cfg, now)
+		case now := <-alertChecks:
+			if alert, ok := alerts.check(now); ok && resultErr == nil {
+				if err := cfg.OnAlert(alert); err != nil {
+					resultErr = fmt.Errorf("alert: %w", err)
+					stopPacers()
+					attacker.Stop()
+				}
+			}
+		case paused := <-cfg.Pauses:
+			if paused {
+				backoff.hold()
+			} else {
+				backoff.resume()
+			}
+		case <-end:
+			stopPacers()
+		case <-done:
+			stopPacers()
+			attacker.Stop()
+			interrupted = true
+			done = nil
+			if cfg.ShutdownTimeout > 0 {
+				shutdown = time.After(cfg.ShutdownTimeout)
+			}
+		case <-deadline:
+			deadlineExceeded = true
+			stopPacers()
+			attacker.Stop()
+			abandoned = sent.Load() - received
+			// Let the abandoned requests finish in the background
+			go func() {
+				for range attack {
+				}
+			}()
+			break loop
+		case <-shutdown:
+			abandoned = sent.Load() - received
+			// Let the abandoned requests finish in the background
+			go func() {
+				for range attack {
+				}
+			}()
+			break loop
+		}
+	}
+
+	results := acc.results()
+	results.Interrupted = interrupted || bytesInCapped || deadlineExceeded
+	results.DeadlineExceeded = deadlineExceeded
+	results.BytesInCapped = bytesInCapped
+	results.IPVersion = cfg.IPVersion
+	results.GeneratorStats = usage.stats()
+	if ramp != nil {
+		results.RampProfile = ramp.results(results.Interrupted)
+	}
+	results.Abandoned = abandoned
+	results.Excluded = excluded
+	if cfg.MeasureTLSHandshake {
+		results.TLSHandshake = handshakes.summary()
+	}
+	if cfg.MeasureLatencyBreakdown {
+		results.LatencyBreakdown = phases.summary()
+	}
+	if cfg.MeasureConnWait {
+		results.ConnWait = connWaits.summary()
+	}
+	if backoff != nil {
+		results.Paused = backoff.heldTotal()
+	}
+	if resultErr != nil {
+		return results, fmt.Errorf("handling result: %w", resultErr)
+	}
+	return results, nil
+}
+
+// randomTargeter hands out one of targets at random every time
+func randomTargeter(targets []vegeta.Target) vegeta.Targeter {
+	return func(tgt *vegeta.Target) error {
+		if tgt == nil {
+			return vegeta.ErrNilTarget
+		}
+		*tgt = targets[rand.IntN(len(targets))]
+		return nil
+	}
+}
+
+// bufferResults relays the results of in through a channel holding up to size
+// of them, closing it when in is closed
+func bufferResults(in <-chan *vegeta.Result, size int) <-chan *vegeta.Result {
+	out := make(chan *vegeta.Result, size)
+	go func() {
+		defer close(out)
+		for res := range in {
+			out <- res
+		}
+	}()
+	return out
+}
+
+// weightedOrder expands weights into one index per unit of weight with smooth
+// weighted round-robin: every step each index gains its weight, the highest
+// (lowest index on ties) is picked and loses the total. Nil without weights.
+func weightedOrder(weights []int) []int {
+	if len(weights) == 0 {
+		return nil
+	}
+	total := 0
+	for _, weight := range weights {
+		total += weight
+	}
+	current := make([]int, len(weights))
+	order := make([]int, total)
+	for step := range order {
+		best := 0
+		for i, weight := range weights {
+			current[i] += weight
+			if current[i] > current[best] {
+				best = i
+			}
+		}
+		current[best] -= total
+		order[step] = best
+	}
+	return order
+}
+
+// countingTargeter counts the targets handed out, one per request sent
+func countingTargeter(targeter vegeta.Targeter, sent *atomic.Uint64) vegeta.Targeter {
+	return func(tgt *vegeta.Target) error {
+		sent.Add(1)
+		return targeter(tgt)
+	}
+}
@@ -0,0 +1,265 @@
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+// benchmarkRate is the rate the benchmarks feed results at
+const benchmarkRate = 10000
+
+// benchmarkResult returns result i of a run at benchmarkRate per second. One in
+// 100 failed with a unique error, like a dial error naming its local port.
+// Results are built as they are needed, like the attack hands them out, so
+// only what the loop keeps stays on the heap.
+func benchmarkResult(i int, began time.Time) vegeta.Result {
+	res := vegeta.Result{
+		Seq:       uint64(i),
+		Code:      200,
+		Timestamp: began.Add(time.Duration(i) * time.Second / benchmarkRate),
+		Latency:   time.Duration(5+i%20) * time.Millisecond,
+		BytesIn:   512,
+	}
+	if i%100 == 0 {
+		res.Code = 0
+		res.Error = fmt.Sprintf("dial tcp 127.0.0.1:%d->10.0.0.1:80: connect: connection refused", 1024+i)
+	}
+	return res
+}
+
+func TestHostHeader(t *testing.T) {
+	var mu sync.Mutex
+	hosts := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hosts[r.Host]++
+		mu.Unlock()
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const host = "api.example.com"
+	cfg := Config{URI: server.URL + "/", HostHeader: host, Rate: 20, Duration: time.Second, Timeout: 5 * time.Second}
+	if err := CheckHealth(cfg, server.URL+"/health", http.StatusOK); err != nil {
+		t.Fatalf("health check: %v", err)
+	}
+	results, err := RunContext(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.Requests == 0 || results.Failures != 0 {
+		t.Fatalf("%d requests, %d failures, want requests and no failures", results.Requests, results.Failures)
+	}
+
+	// The requests reached the server at the URI's address with the override as Host
+	mu.Lock()
+	defer mu.Unlock()
+	if want := int(results.Requests) + 1; hosts[host] != want || len(hosts) != 1 {
+		t.Errorf("hosts seen %v, want %s %d times", hosts, host, want)
+	}
+
+	// Only the Host header changes, the URL still points at the target
+	var tgt vegeta.Target
+	if err := NewTargeter(cfg)(&tgt); err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(tgt.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != target.Host || tgt.Header.Get("Host") != host {
+		t.Errorf("target URL host %s and Host header %q, want %s and %q", u.Host, tgt.Header.Get("Host"), target.Host, host)
+	}
+}
+
+func TestRawURLTLS(t *testing.T) {
+	var mu sync.Mutex
+	paths := map[string]int{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths[r.RequestURI]++
+		mu.Unlock()
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// Raw URL mode swaps in its own client, which must not start verifying the self-signed certificate.
+	// Go would send the ü escaped as %C3%BC.
+	const path = "/ü"
+	cfg := Config{URI: server.URL + path, RawURL: true, Rate: 20, Duration: time.Second, Timeout: 5 * time.Second}
+	results, err := RunContext(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.Requests == 0 || results.Failures != 0 {
+		t.Fatalf("%d requests, %d failures, want requests and no failures", results.Requests, results.Failures)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if paths[path] != int(results.Requests) || len(paths) != 1 {
+		t.Errorf("paths seen %v, want %s %d times", paths, path, results.Requests)
+	}
+}
+
+func TestRandomBodyPool(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		weights []int
+		want    map[string]int
+	}{
+		{"no weights", nil, map[string]int{"a": 2000, "b": 2000, "c": 2000}},
+		{"weights", []int{5, 1, 1}, map[string]int{"a": 5000, "b": 1000, "c": 1000}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := Config{
+				URI:            "http://localhost/",
+				Method:         "POST",
+				BodyPool:       [][]byte{[]byte("a"), []byte("b"), []byte("c")},
+				BodyWeights:    test.weights,
+				BodyPoolRandom: true,
+				Rate:           1,
+				Duration:       time.Second,
+				Timeout:        time.Second,
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			targeter := NewTargeter(cfg)
+			picks, wantRepeats := 0, 0.0
+			for _, want := range test.want {
+				picks += want
+			}
+			for _, want := range test.want {
+				wantRepeats += float64(want) * float64(want) / float64(picks)
+			}
+			counts := map[string]int{}
+			repeats, last := 0, ""
+			for range picks {
+				var tgt vegeta.Target
+				if err := targeter(&tgt); err != nil {
+					t.Fatal(err)
+				}
+				counts[string(tgt.Body)]++
+				if string(tgt.Body) == last {
+					repeats++
+				}
+				last = string(tgt.Body)
+			}
+			// Far outside 20% only by a broken weighting
+			for body, want := range test.want {
+				if got := counts[body]; got < want*8/10 || got > want*12/10 {
+					t.Errorf("body %s picked %d times in %d, want about %d", body, got, picks, want)
+				}
+			}
+			// Taking turns through the table repeats a body less often than chance does
+			if diff := float64(repeats) - wantRepeats; diff < -float64(picks)/20 || diff > float64(picks)/20 {
+				t.Errorf("same body picked twice in a row %d times in %d, want about %.0f", repeats, picks, wantRepeats)
+			}
+		})
+	}
+
+	cfg := Config{URI: "http://localhost/", BodyPoolRandom: true, Rate: 1, Duration: time.Second, Timeout: time.Second}
+	if err := cfg.Validate(); err == nil {
+		t.Error("random order without a body pool is valid, want an error")
+	}
+}
+
+func TestWeightedOrder(t *testing.T) {
+	for _, test := range []struct {
+		weights []int
+		want    []int
+	}{
+		{nil, nil},
+		{[]int{}, nil},
+		{[]int{3}, []int{0, 0, 0}},
+		{[]int{5, 1, 1}, []int{0, 0, 1, 0, 2, 0, 0}},
+		{[]int{1, 2}, []int{1, 0, 1}},
+		// Ties go to the lowest index
+		{[]int{1, 1}, []int{0, 1}},
+		{[]int{2, 2}, []int{0, 1, 0, 1}},
+		{[]int{1, 1, 1}, []int{0, 1, 2}},
+		{[]int{2, 1, 2}, []int{0, 2, 1, 0, 2}},
+	} {
+		if got := weightedOrder(test.weights); !slices.Equal(got, test.want) {
+			t.Errorf("weightedOrder(%v) = %v, want %v", test.weights, got, test.want)
+		}
+	}
+}
+
+func TestWeightedTargeter(t *testing.T) {
+	cfg := Config{
+		URI:         "http://localhost/",
+		Method:      "POST",
+		BodyPool:    [][]byte{[]byte("a"), []byte("b"), []byte("c")},
+		BodyWeights: []int{5, 1, 1},
+	}
+	targeter := NewTargeter(cfg)
+	var bodies []string
+	for range 14 {
+		var tgt vegeta.Target
+		if err := targeter(&tgt); err != nil {
+			t.Fatal(err)
+		}
+		bodies = append(bodies, string(tgt.Body))
+	}
+	// The table repeats after one round
+	if got, want := strings.Join(bodies, " "), "a a b a c a a a a b a c a a"; got != want {
+		t.Errorf("bodies %q, want %q", got, want)
+	}
+}
+
+// BenchmarkResultBuffer hands results over at benchmarkRate to a loop that stalls
+// for 20ms every 2000 results, like -encode writing to a slow disk, and reports
+// how long the workers were blocked handing them over. Without a buffer every
+// stall holds up the 200 results due during it.
+func BenchmarkResultBuffer(b *testing.B) {
+	for _, size := range []int{0, benchmarkRate} {
+		b.Run(fmt.Sprintf("buffer=%d", size), func(b *testing.B) {
+			in := make(chan *vegeta.Result)
+			var out <-chan *vegeta.Result = in
+			if size > 0 {
+				out = bufferResults(in, size)
+			}
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				n := 0
+				for range out {
+					if n++; n%2000 == 0 {
+						time.Sleep(20 * time.Millisecond)
+					}
+				}
+			}()
+
+			began := time.Now()
+			var blocked time.Duration
+			for i := range b.N {
+				due := began.Add(time.Duration(i) * time.Second / benchmarkRate)
+				if wait := time.Until(due); wait > 0 {
+					time.Sleep(wait)
+				}
+				res := benchmarkResult(i, began)
+				sending := time.Now()
+				in <- &res
+				blocked += time.Since(sending)
+			}
+			close(in)
+			<-done
+			b.ReportMetric(float64(blocked)/float64(b.N), "blocked-ns/op")
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package loadtest
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/url"
+	"sort"
+)
+
+// MultipartFile is a file part of a multipart body
+type MultipartFile struct {
+	Field    string // Form field name
+	Filename string // File name sent to the server
+	Content  []byte
+}
+
+// FormBody encodes values as an application/x-www-form-urlencoded body,
+// returning the body and its Content-Type
+func FormBody(values url.Values) ([]byte, string) {
+	return []byte(values.Encode()), "application/x-www-form-urlencoded"
+}
+
+// MultipartBody encodes fields and files as a multipart/form-data body,
+// returning the body and its Content-Type with the boundary
+func MultipartBody(fields url.Values, files []MultipartFile) ([]byte, string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range fields[name] {
+			if err := writer.WriteField(name, value); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	for _, file := range files {
+		part, err := writer.CreateFormFile(file.Field, file.Filename)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := part.Write(file.Content); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return body.Bytes(), writer.FormDataContentType(), nil
+}
+
+// DedupeBodyPool removes the bodies identical to an earlier one, and their weights
+// when weights is not nil, and returns how many were removed. The first of each
+// keeps its place and weight, so duplicates no longer send a body more often.
+func DedupeBodyPool(pool [][]byte, weights []int) ([][]byte, []int, int) {
+	seen := map[string]bool{}
+	deduped := [][]byte{}
+	var dedupedWeights []int
+	for i, body := range pool {
+		if seen[string(body)] {
+			continue
+		}
+		seen[string(body)] = true
+		deduped = append(deduped, body)
+		if weights != nil {
+			dedupedWeights = append(dedupedWeights, weights[i])
+		}
+	}
+	return deduped, dedupedWeights, len(pool) - len(deduped)
+}
@@ -0,0 +1,43 @@
+package loadtest
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDedupeBodyPool(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		pool        []string
+		weights     []int
+		want        []string
+		wantWeights []int
+		dropped     int
+	}{
+		// The first body keeps its weight, the weights of its duplicates are dropped with them
+		{"duplicates", []string{"a", "b", "a", "c", "a", "b"}, []int{1, 1, 1, 2, 1, 5}, []string{"a", "b", "c"}, []int{1, 1, 2}, 3},
+		{"no weights", []string{"a", "b", "a", "c", "a", "b"}, nil, []string{"a", "b", "c"}, nil, 3},
+		{"no duplicates", []string{"a", "b", "c"}, []int{3, 2, 1}, []string{"a", "b", "c"}, []int{3, 2, 1}, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			pool := [][]byte{}
+			for _, body := range test.pool {
+				pool = append(pool, []byte(body))
+			}
+			deduped, weights, dropped := DedupeBodyPool(pool, test.weights)
+			got := []string{}
+			for _, body := range deduped {
+				got = append(got, string(body))
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("pool %q, want %q", got, test.want)
+			}
+			if !slices.Equal(weights, test.wantWeights) || (weights == nil) != (test.wantWeights == nil) {
+				t.Errorf("weights %v, want %v", weights, test.wantWeights)
+			}
+			if dropped != test.dropped {
+				t.Errorf("dropped %d, want %d", dropped, test.dropped)
+			}
+		})
+	}
+}
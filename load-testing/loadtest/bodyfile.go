@@ -0,0 +1,50 @@
+package loadtest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// fileBodyTransport sends Config.BodyFile as the body of every request, read
+// from disk while it is sent so the file is never held in memory. Every request
+// opens the file again, the operating system's page cache keeps it fast.
+type fileBodyTransport struct {
+	path string
+	next http.RoundTripper
+}
+
+func (t *fileBodyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	file, size, err := openBodyFile(t.path)
+	if err != nil {
+		return nil, err
+	}
+	// A RoundTripper must not modify the request it was given
+	req = req.Clone(req.Context())
+	req.Body = file
+	req.ContentLength = size
+	req.GetBody = func() (io.ReadCloser, error) {
+		file, _, err := openBodyFile(t.path)
+		return file, err
+	}
+	return t.next.RoundTrip(req)
+}
+
+// openBodyFile opens a regular file and returns its size
+func openBodyFile(path string) (*os.File, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	if !info.Mode().IsRegular() {
+		file.Close()
+		return nil, 0, fmt.Errorf("%s is not a regular file", path)
+	}
+	return file, info.Size(), nil
+}
@@ -0,0 +1,170 @@
+package loadtest
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/influxdata/tdigest"
+)
+
+// LatencyBreakdownResults splits request latency into phases, to tell slow
+// connection setup from slow server processing. DNS, Connect and TLS only
+// happen on new connections, so with keep-alive they have fewer samples.
+type LatencyBreakdownResults struct {
+	DNS      PhaseLatency `json:"dns"`
+	Connect  PhaseLatency `json:"connect"`
+	TLS      PhaseLatency `json:"tls"`
+	TTFB     PhaseLatency `json:"ttfb"`     // From having a connection to the first response byte
+	Transfer PhaseLatency `json:"transfer"` // From the first response byte to the end of the body
+}
+
+// PhaseLatency holds the durations of one phase of a request
+type PhaseLatency struct {
+	Samples uint64        `json:"samples"`
+	Mean    time.Duration `json:"mean"`
+	P50     time.Duration `json:"p50"`
+	P90     time.Duration `json:"p90"`
+	P99     time.Duration `json:"p99"`
+	Max     time.Duration `json:"max"`
+}
+
+type phase int
+
+const (
+	phaseDNS phase = iota
+	phaseConnect
+	phaseTLS
+	phaseTTFB
+	phaseTransfer
+	phaseCount
+)
+
+// phaseDurations collects the durations of one phase
+type phaseDurations struct {
+	samples uint64
+	total   time.Duration
+	max     time.Duration
+	digest  *tdigest.TDigest
+}
+
+func (p *phaseDurations) summary() PhaseLatency {
+	latency := PhaseLatency{Samples: p.samples, Max: p.max}
+	if p.samples > 0 {
+		latency.Mean = p.total / time.Duration(p.samples)
+		latency.P50 = time.Duration(p.digest.Quantile(0.50))
+		latency.P90 = time.Duration(p.digest.Quantile(0.90))
+		latency.P99 = time.Duration(p.digest.Quantile(0.99))
+	}
+	return latency
+}
+
+// phaseRecorder collects phase durations from every worker
+type phaseRecorder struct {
+	mu     sync.Mutex
+	phases [phaseCount]phaseDurations
+}
+
+func newPhaseRecorder() *phaseRecorder {
+	r := &phaseRecorder{}
+	for i := range r.phases {
+		r.phases[i].digest = tdigest.NewWithCompression(100)
+	}
+	return r
+}
+
+func (r *phaseRecorder) add(p phase, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	durations := &r.phases[p]
+	durations.samples++
+	durations.total += d
+	if d > durations.max {
+		durations.max = d
+	}
+	durations.digest.Add(float64(d), 1)
+}
+
+func (r *phaseRecorder) summary() *LatencyBreakdownResults {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &LatencyBreakdownResults{
+		DNS:      r.phases[phaseDNS].summary(),
+		Connect:  r.phases[phaseConnect].summary(),
+		TLS:      r.phases[phaseTLS].summary(),
+		TTFB:     r.phases[phaseTTFB].summary(),
+		Transfer: r.phases[phaseTransfer].summary(),
+	}
+}
+
+// phaseTraceTransport records the phases of every request with httptrace.
+// The transfer phase ends when the body is closed, Vegeta reads it all first.
+type phaseTraceTransport struct {
+	recorder *phaseRecorder
+	next     http.RoundTripper
+}
+
+func (t *phaseTraceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Dialing may try several addresses at once, so starts are guarded
+	var mu sync.Mutex
+	var dnsStart, connectStart, tlsStart, gotConn, firstByte time.Time
+	started := func(at *time.Time) {
+		mu.Lock()
+		*at = time.Now()
+		mu.Unlock()
+	}
+	done := func(p phase, at *time.Time) {
+		mu.Lock()
+		start := *at
+		mu.Unlock()
+		if !start.IsZero() {
+			t.recorder.add(p, time.Since(start))
+		}
+	}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { started(&dnsStart) },
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			if info.Err == nil {
+				done(phaseDNS, &dnsStart)
+			}
+		},
+		ConnectStart: func(string, string) { started(&connectStart) },
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				done(phaseConnect, &connectStart)
+			}
+		},
+		TLSHandshakeStart: func() { started(&tlsStart) },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil {
+				done(phaseTLS, &tlsStart)
+			}
+		},
+		GotConn: func(httptrace.GotConnInfo) { started(&gotConn) },
+		GotFirstResponseByte: func() {
+			done(phaseTTFB, &gotConn)
+			started(&firstByte)
+		},
+	}
+	res, err := t.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err != nil {
+		return res, err
+	}
+	res.Body = &transferTimer{ReadCloser: res.Body, done: func() { done(phaseTransfer, &firstByte) }}
+	return res, nil
+}
+
+// transferTimer ends the transfer phase when the body is closed
+type transferTimer struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (t *transferTimer) Close() error {
+	t.once.Do(t.done)
+	return t.ReadCloser.Close()
+}
@@ -0,0 +1,54 @@
+package loadtest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+// ChaosHeader asks a mock server to inject latency or errors, for example
+// X-Chaos-Fail-Rate: 0.1. It only has an effect when the server honors it.
+type ChaosHeader struct {
+	Name   string   // Header name, empty sends no chaos header
+	Values []string // Values sent in turn, one per request
+}
+
+func (c ChaosHeader) isSet() bool {
+	return c.Name != ""
+}
+
+func (c ChaosHeader) validate() error {
+	if !c.isSet() {
+		return nil
+	}
+	if len(c.Values) == 0 {
+		return errors.New("chaos header needs at least one value")
+	}
+	for _, value := range c.Values {
+		if err := addHeader(http.Header{}, c.Name, value); err != nil {
+			return fmt.Errorf("chaos %w", err)
+		}
+	}
+	return nil
+}
+
+// chaosTargeter stamps every target with the next chaos header value.
+// Targets share their header map, so each one gets a copy.
+func chaosTargeter(targeter vegeta.Targeter, chaos ChaosHeader) vegeta.Targeter {
+	var next atomic.Uint64
+	return func(tgt *vegeta.Target) error {
+		if err := targeter(tgt); err != nil {
+			return err
+		}
+		header := tgt.Header.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		header.Set(chaos.Name, chaos.Values[(next.Add(1)-1)%uint64(len(chaos.Values))])
+		tgt.Header = header
+		return nil
+	}
+}
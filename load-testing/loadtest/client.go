@@ -0,0 +1,76 @@
+package loadtest
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// newClient mirrors the attacker settings used in NewAttacker
+// (keep-alive, idle connections, TLS, no HTTP/2, no redirects) and adds the
+// IP version, connection limits, buffer sizes, TCP_NODELAY and transports Vegeta has no option for: rawURLTransport,
+// fileBodyTransport, simTransport, tlsTraceTransport, phaseTraceTransport and connWaitTransport. handshakes is only used with Config.MeasureTLSHandshake,
+// phases with Config.MeasureLatencyBreakdown, connWaits with Config.MeasureConnWait.
+func newClient(cfg Config, handshakes *handshakeRecorder, phases *phaseRecorder, connWaits *connWaitRecorder) *http.Client {
+	dialer := &net.Dialer{KeepAlive: 30 * time.Second}
+	if !cfg.KeepAlive {
+		dialer.KeepAlive = -1
+	}
+	pool := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: func(ctx context.Context, network string, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, cfg.network(network), addr)
+			if err != nil || !cfg.DisableTCPNoDelay {
+				return conn, err
+			}
+			// Go sets TCP_NODELAY after dialing, so it cannot be cleared in Dialer.Control
+			if tcp, ok := conn.(*net.TCPConn); ok {
+				if err := tcp.SetNoDelay(false); err != nil {
+					conn.Close()
+					return nil, err
+				}
+			}
+			return conn, nil
+		},
+		DisableKeepAlives:   !cfg.KeepAlive,
+		MaxIdleConnsPerHost: cfg.maxIdleConnsPerHost(),
+		MaxConnsPerHost:     cfg.MaxConnsPerHost,
+		ReadBufferSize:      cfg.ReadBufferSize,
+		WriteBufferSize:     cfg.WriteBufferSize,
+		TLSClientConfig:     cfg.TLS.clientConfig(),
+		ForceAttemptHTTP2:   false,
+		TLSNextProto:        map[string]func(string, *tls.Conn) http.RoundTripper{},
+	}
+	if cfg.MaxTotalConns > 0 {
+		pool.DialContext = newConnLimiter(cfg.MaxTotalConns).dial(pool.DialContext)
+	}
+	var transport http.RoundTripper = pool
+	if cfg.RawURL {
+		transport = newRawURLTransport(cfg, transport)
+	}
+	if cfg.BodyFile != "" {
+		transport = &fileBodyTransport{path: cfg.BodyFile, next: transport}
+	}
+	if cfg.MeasureTLSHandshake {
+		transport = &tlsTraceTransport{recorder: handshakes, next: transport}
+	}
+	if cfg.MeasureLatencyBreakdown {
+		transport = &phaseTraceTransport{recorder: phases, next: transport}
+	}
+	if cfg.MeasureConnWait {
+		transport = &connWaitTransport{recorder: connWaits, next: transport}
+	}
+	if cfg.NetworkSim.isSet() {
+		transport = &simTransport{sim: cfg.NetworkSim, next: transport}
+	}
+	return &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: transport,
+		CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
+			return errors.New("stopped after 0 redirects")
+		},
+	}
+}
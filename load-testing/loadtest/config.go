@@ -0,0 +1,591 @@
+// Package loadtest runs a constant rate load test against a single URI
+// using the Vegeta library. The load-test command is a thin wrapper around it.
+package loadtest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+// MaxConnectionPoolConns caps the connection pool settings
+const MaxConnectionPoolConns int = 10000
+
+// MaxResultBuffer caps Config.ResultBuffer, a minute of results at 10k/s
+const MaxResultBuffer int = 600000
+
+// MaxHeaderCount and MaxHeaderBytes cap the headers sent with every request,
+// Config.Header, Config.HostHeader, Config.DefaultContentType and Config.ChaosHeader together. Servers
+// commonly reject more than 8-16KiB of headers, so these are already generous.
+const (
+	MaxHeaderCount int = 100
+	MaxHeaderBytes int = 64 * 1024
+)
+
+// MaxBodyWeightTotal caps the sum of Config.BodyWeights, one target is kept per unit of weight
+const MaxBodyWeightTotal int = 10000
+
+// MaxTransportBufferSize caps Config.ReadBufferSize and WriteBufferSize,
+// every connection holds both buffers
+const MaxTransportBufferSize int = 1024 * 1024
+
+// DefaultMinSamples is used when Config.MinSamples is zero.
+// With fewer samples the 99th percentile is one of the slowest few requests.
+const DefaultMinSamples uint64 = 100
+
+// MaxBodyMatchBytes caps how much of each response body the body regexes scan
+const MaxBodyMatchBytes int = 64 * 1024
+
+// DefaultRateTolerance is used when Config.RateTolerance is zero
+const DefaultRateTolerance float64 = 0.1
+
+// Config describes a single load test
+type Config struct {
+	// Name is the Vegeta attack name, sent in the X-Vegeta-Attack header and
+	// stored in every result so vegeta report can tell attacks apart. Defaults to AttackName.
+	Name string
+
+	URI      string        // Target URI
+	Method   string        // HTTP method, defaults to GET
+	Body     []byte        // Request body, optional
+	Header   http.Header   // Request headers, optional
+	BodyPool [][]byte      // Bodies sent in turn instead of Body, so identical bodies do not hit caches, optional
+	Rate     int           // Requests per RatePer
+	RatePer  time.Duration // Unit of Rate, for example time.Minute for 30 per minute, 0 is per second
+	Duration time.Duration // Length of the attack
+	Timeout  time.Duration // Per request timeout
+	RawURL   bool          // Send the paths of URI and Replay exactly as written, see notes/url_normalization.md
+
+	// SoftTimeout counts requests that ran out of Timeout as neither a success nor
+	// a failure, to tell a slow target from a broken one. They are still cancelled
+	// at Timeout and counted in Results.Requests, Rate and the latencies, but
+	// only in Results.Timeouts and not in Failures, Success, Errors or StatusCodes.
+	SoftTimeout bool
+
+	// BodyFile is sent as the body of every request instead of Body, read from
+	// disk while the request is sent, for uploads too large to keep in memory.
+	// Results.BytesOut counts its size for every request that got a response.
+	BodyFile string
+
+	// HostHeader is sent as the Host header instead of the URI's host, to test
+	// virtual hosts and routing rules while connecting to URI, for example an IP.
+	// For https set TLS.ServerName too. Empty sends the URI's host.
+	HostHeader string
+
+	// DefaultContentType is sent as the Content-Type of requests with a Body,
+	// BodyPool or BodyFile when Header has none, for APIs that are JSON throughout.
+	// A Content-Type in Header, like the one of FormBody, takes precedence.
+	DefaultContentType string
+
+	// RateSchedule replays a recorded traffic shape instead of a constant Rate:
+	// RateSchedule[s] requests are sent during second s of the attack. When it
+	// is shorter than Duration the attack stops at its end, or starts over with
+	// RateScheduleLoop. Rate and RatePer are ignored when it is set.
+	RateSchedule     []int
+	RateScheduleLoop bool
+
+	// Replay sends these requests instead of URI, each at its recorded time, for
+	// example from ParseHAR. Every URL must be on the URI's host. The attack stops
+	// after the last one or at Duration. Method, Body, BodyPool, Rate, RatePer and
+	// RateSchedule are ignored; Header, HostHeader and DefaultContentType fill in
+	// what a request does not have.
+	Replay []ReplayRequest
+
+	// BodyWeights sends BodyPool[i] BodyWeights[i] times per round instead of once,
+	// in a fixed interleaved order, see NewTargeter. Optional, one weight per body.
+	BodyWeights []int
+
+	// BodyPoolRandom picks a BodyPool body at random for every request instead of
+	// in turn, in proportion to BodyWeights when they are set. The order then
+	// differs between runs.
+	BodyPoolRandom bool
+
+	// ChaosHeader sends a header asking a mock server to inject latency or errors
+	ChaosHeader ChaosHeader
+
+	// TLS restricts the versions and cipher suites for https targets
+	TLS TLSConfig
+
+	// NetworkSim adds latency and errors on this side of the network, see README
+	NetworkSim NetworkSimConfig
+
+	// Fuzz sends some requests with a truncated, duplicated or corrupted body,
+	// needs Body, BodyPool or Replay
+	Fuzz FuzzConfig
+
+	// MeasureTLSHandshake reports the TLS handshake durations of new connections
+	// and how many requests reused a connection in Results.TLSHandshake
+	MeasureTLSHandshake bool
+
+	// MeasureLatencyBreakdown reports how long requests spend in DNS, connect,
+	// TLS, waiting for the first byte and reading the body in Results.LatencyBreakdown
+	MeasureLatencyBreakdown bool
+
+	// MeasureConnWait reports how often and how long requests waited for a
+	// connection from the pool in Results.ConnWait, see MaxConnsPerHost and MaxTotalConns
+	MeasureConnWait bool
+
+	// ExpectContentType counts responses whose Content-Type media type is different,
+	// for example "application/json". Parameters like charset are ignored.
+	// Not checked for HEAD and OPTIONS, see expectsBody.
+	ExpectContentType string
+
+	// SuccessBodyRegex and FailureBodyRegex decide success from the response body,
+	// for APIs like GraphQL that return 200 with an error in the body. A response
+	// is a body success when it has no error, matches SuccessBodyRegex and does
+	// not match FailureBodyRegex. Empty regexes are not checked. Only the first
+	// MaxBodyMatchBytes of the body are scanned. See Results.BodySuccess.
+	SuccessBodyRegex string
+	FailureBodyRegex string
+
+	// Connection pool
+	KeepAlive           bool // Reuse connections between requests
+	MaxIdleConnsPerHost int  // Idle connections kept open per host when KeepAlive is on, 0 uses Vegeta's default
+	MaxConnsPerHost     int  // Open connections per host, requests beyond it wait for a free one, 0 is unlimited
+	MaxTotalConns       int  // Open connections to all hosts together, requests beyond it wait, 0 is unlimited
+
+	// IPVersion forces connections over IPv4 ("4") or IPv6 ("6") for targets
+	// with both A and AAAA records, to compare the stacks. Empty lets Go pick.
+	IPVersion string
+
+	// Per connection buffers between the HTTP client and the socket, 0 uses Go's default (4KiB).
+	// Larger buffers mean fewer system calls for large bodies, smaller ones less memory per connection.
+	ReadBufferSize  int
+	WriteBufferSize int
+
+	// DisableTCPNoDelay turns Nagle's algorithm back on. Go sets TCP_NODELAY on every
+	// connection, so small writes go out at once instead of waiting to be merged
+	// with the next one or for the ACK of the previous one. Turning it off shows how
+	// much a target or proxy with Nagle on would add to small request latencies,
+	// up to the peer's delayed ACK timeout (40ms on Linux) when a request takes
+	// more than one write.
+	DisableTCPNoDelay bool
+
+	// Workers sending requests, 0 uses Vegeta's defaults (10 initial, no maximum).
+	// Vegeta starts more workers whenever all of them are busy, for example
+	// waiting on slow responses, up to MaxWorkers.
+	Workers    uint64
+	MaxWorkers uint64
+
+	// ResultBuffer queues this many results between Vegeta's workers and the
+	// results loop, so a result handler that stalls for a moment, like OnResult
+	// flushing a file to a slow disk, does not hold up the workers and the rate.
+	// 0 hands every result over directly.
+	ResultBuffer int
+
+	// CapWorkersToFileLimit lowers MaxWorkers to fit the open file limit (ulimit -n)
+	// so the generator does not fail with "too many open files". Unix only.
+	CapWorkersToFileLimit bool
+
+	// ShutdownTimeout caps how long RunContext waits for requests in flight
+	// after its context is cancelled, 0 waits for all of them (at most Timeout)
+	ShutdownTimeout time.Duration
+
+	// RetryAfter pauses new requests when a 429 response has a Retry-After header,
+	// see "Rate Limiting" in the README for how this interacts with the rate
+	RetryAfter bool
+
+	// Pauses holds the attack when true is received and resumes it on false, optional.
+	// Held time counts toward Duration but is hidden from the pacer, like RetryAfter.
+	Pauses <-chan bool
+
+	// MaxErrorSamples caps the distinct error messages kept in Results.Errors,
+	// so errors with unique text (ports, request IDs) cannot grow memory without bound.
+	// Failures still counts every failed request. 0 keeps every distinct error.
+	MaxErrorSamples int
+
+	// ErrorWindow splits the test into windows of this length and reports
+	// the error rate of each one in Results.ErrorRates, 0 disables it
+	ErrorWindow time.Duration
+
+	// RampBand groups the results by the configured rate when each request was
+	// sent, in bands this many requests per second wide, and reports them in
+	// Results.RampProfile. With a RateSchedule that ramps up this shows the rate
+	// where latency and errors start to climb. 0 disables it.
+	RampBand float64
+
+	// ExcludeFirst leaves the results of requests sent in the first part of the attack
+	// out of Results, for targets that need to warm up like a cold lambda.
+	// They are still sent, passed to OnResult and counted in Results.Excluded.
+	ExcludeFirst time.Duration
+
+	// SnapshotInterval calls OnSnapshot every interval during the attack with the
+	// results of the requests received since the previous snapshot, 0 disables it.
+	// This shows drift like latency creeping up on long soak tests as it happens.
+	SnapshotInterval time.Duration
+
+	// LatencyUnit is how Results.Latencies are written as JSON: LatencyUnitString
+	// (the default when empty), LatencyUnitMs or LatencyUnitNs
+	LatencyUnit string
+
+	// LatenciesMs adds Results.LatenciesMs, the latencies as numbers of
+	// milliseconds next to the duration strings of Results.Latencies
+	LatenciesMs bool
+
+	// Deadline bounds the whole run, including the wait for slow responses,
+	// for targets that trickle bytes slowly enough to never hit Timeout. When it
+	// passes the attack stops at once, requests still in flight are counted in
+	// Results.Abandoned and Results.DeadlineExceeded is set. 0 is no deadline,
+	// otherwise it must be longer than Duration.
+	Deadline time.Duration
+
+	// MaxBytesIn stops the attack once the responses received add up to more
+	// than this many bytes, a safety valve against endpoints that unexpectedly
+	// stream huge responses. Sets Results.BytesInCapped. 0 is unlimited.
+	MaxBytesIn int64
+
+	// LiveAlert calls OnAlert when the rolling p99 latency goes above a threshold
+	LiveAlert LiveAlertConfig
+
+	// MinSamples is the request count below which percentiles are marked unreliable,
+	// 0 uses DefaultMinSamples
+	MinSamples uint64
+
+	// RateTolerance is the fraction of Rate the achieved rate may fall short by
+	// before the test is reported as generator limited, 0 uses DefaultRateTolerance
+	RateTolerance float64
+
+	// Thresholds are not enforced by Run, check them with Thresholds.Check
+	Thresholds Thresholds
+
+	// OnResult is called with every result as it arrives, optional.
+	// Returning an error stops the attack and Run returns that error.
+	OnResult func(*vegeta.Result) error
+
+	// OnSnapshot is called with the results of every SnapshotInterval, optional.
+	// Returning an error stops the attack and Run returns that error.
+	OnSnapshot func(Results) error
+
+	// OnAlert is called for every LiveAlert, optional.
+	// Returning an error stops the attack and Run returns that error.
+	OnAlert func(Alert) error
+}
+
+// Validate checks the config can be used to run a load test
+func (c Config) Validate() error {
+	u, err := url.Parse(c.URI)
+	if err != nil {
+		return fmt.Errorf("invalid URI: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid URI: scheme must be http or https, got %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return errors.New("invalid URI: missing host")
+	}
+	if len(c.Replay) > 0 {
+		if err := validateReplay(c.Replay, u); err != nil {
+			return err
+		}
+	} else if len(c.RateSchedule) > 0 {
+		if err := validateRateSchedule(c.RateSchedule); err != nil {
+			return err
+		}
+	} else if c.Rate <= 0 {
+		return fmt.Errorf("rate must be positive, got %d", c.Rate)
+	}
+	if len(c.Body) > 0 && len(c.BodyPool) > 0 {
+		return errors.New("body and body pool cannot both be set")
+	}
+	if c.BodyPoolRandom && len(c.BodyPool) == 0 {
+		return errors.New("random body order needs a body pool")
+	}
+	if c.BodyFile != "" {
+		if len(c.Body) > 0 || len(c.BodyPool) > 0 || len(c.Replay) > 0 {
+			return errors.New("body file cannot be combined with body, body pool or replay")
+		}
+		file, _, err := openBodyFile(c.BodyFile)
+		if err != nil {
+			return fmt.Errorf("invalid body file: %w", err)
+		}
+		file.Close()
+	}
+	if len(c.BodyWeights) > 0 {
+		if len(c.BodyWeights) != len(c.BodyPool) {
+			return fmt.Errorf("body weights must have one weight per body (%d), got %d", len(c.BodyPool), len(c.BodyWeights))
+		}
+		total := 0
+		for _, weight := range c.BodyWeights {
+			if weight <= 0 {
+				return fmt.Errorf("body weights must be positive, got %d", weight)
+			}
+			total += weight
+		}
+		if total > MaxBodyWeightTotal {
+			return fmt.Errorf("body weights must add up to at most %d, got %d", MaxBodyWeightTotal, total)
+		}
+	}
+	if c.RatePer < 0 {
+		return fmt.Errorf("rate unit must not be negative, got %s", c.RatePer)
+	}
+	if c.Duration <= 0 {
+		return fmt.Errorf("duration must be positive, got %s", c.Duration)
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("timeout must be positive, got %s", c.Timeout)
+	}
+	if err := c.validateHeaderSize(); err != nil {
+		return err
+	}
+	if err := c.TLS.validate(); err != nil {
+		return err
+	}
+	if err := c.NetworkSim.validate(); err != nil {
+		return err
+	}
+	if err := c.ChaosHeader.validate(); err != nil {
+		return err
+	}
+	if err := c.Fuzz.validate(); err != nil {
+		return err
+	}
+	if c.Fuzz.isSet() && len(c.Body) == 0 && len(c.BodyPool) == 0 && len(c.Replay) == 0 {
+		return errors.New("fuzz needs a body, body pool or replay to malform, a body file is not read into memory")
+	}
+	if c.ExpectContentType != "" {
+		if mediaType, params, err := mime.ParseMediaType(c.ExpectContentType); err != nil || len(params) > 0 || mediaType != c.ExpectContentType {
+			return fmt.Errorf("expected content type must be a lowercase media type without parameters, got %q", c.ExpectContentType)
+		}
+	}
+	for _, expr := range []string{c.SuccessBodyRegex, c.FailureBodyRegex} {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("invalid body regex: %w", err)
+		}
+	}
+	if c.MaxIdleConnsPerHost < 0 || c.MaxIdleConnsPerHost > MaxConnectionPoolConns {
+		return fmt.Errorf("max idle connections per host must be between 0 and %d, got %d", MaxConnectionPoolConns, c.MaxIdleConnsPerHost)
+	}
+	if c.MaxConnsPerHost < 0 || c.MaxConnsPerHost > MaxConnectionPoolConns {
+		return fmt.Errorf("max connections per host must be between 0 and %d, got %d", MaxConnectionPoolConns, c.MaxConnsPerHost)
+	}
+	if c.MaxTotalConns < 0 || c.MaxTotalConns > MaxConnectionPoolConns {
+		return fmt.Errorf("max total connections must be between 0 and %d, got %d", MaxConnectionPoolConns, c.MaxTotalConns)
+	}
+	if c.DefaultContentType != "" {
+		if _, _, err := mime.ParseMediaType(c.DefaultContentType); err != nil {
+			return fmt.Errorf("default content type must be a media type like application/json, got %q: %w", c.DefaultContentType, err)
+		}
+	}
+	if c.HostHeader != "" {
+		if h, err := url.Parse("http://" + c.HostHeader); err != nil || h.Host != c.HostHeader || h.Hostname() == "" {
+			return fmt.Errorf("host header must be a host with an optional port, got %q", c.HostHeader)
+		}
+	}
+	if err := c.validateIPVersion(u.Hostname()); err != nil {
+		return err
+	}
+	for _, size := range []int{c.ReadBufferSize, c.WriteBufferSize} {
+		if size < 0 || size > MaxTransportBufferSize {
+			return fmt.Errorf("buffer sizes must be between 0 and %d bytes, got %d", MaxTransportBufferSize, size)
+		}
+	}
+	if c.MaxErrorSamples < 0 {
+		return fmt.Errorf("max error samples must not be negative, got %d", c.MaxErrorSamples)
+	}
+	if c.ErrorWindow < 0 {
+		return fmt.Errorf("error window must not be negative, got %s", c.ErrorWindow)
+	}
+	if c.RampBand < 0 || math.IsNaN(c.RampBand) || math.IsInf(c.RampBand, 0) {
+		return fmt.Errorf("ramp band must be a positive number of requests per second or 0, got %g", c.RampBand)
+	}
+	if c.ExcludeFirst < 0 || c.ExcludeFirst >= c.Duration {
+		return fmt.Errorf("exclude first must be between 0 and the duration (%s), got %s", c.Duration, c.ExcludeFirst)
+	}
+	if c.SnapshotInterval < 0 {
+		return fmt.Errorf("snapshot interval must not be negative, got %s", c.SnapshotInterval)
+	}
+	if c.Deadline < 0 || (c.Deadline > 0 && c.Deadline <= c.Duration) {
+		return fmt.Errorf("deadline must be longer than the duration (%s), got %s", c.Duration, c.Deadline)
+	}
+	if c.MaxBytesIn < 0 {
+		return fmt.Errorf("max bytes in must not be negative, got %d", c.MaxBytesIn)
+	}
+	switch c.LatencyUnit {
+	case "", LatencyUnitString, LatencyUnitMs, LatencyUnitNs:
+	default:
+		return fmt.Errorf("latency unit must be %s, %s or %s, got %q", LatencyUnitString, LatencyUnitMs, LatencyUnitNs, c.LatencyUnit)
+	}
+	if err := c.LiveAlert.validate(); err != nil {
+		return err
+	}
+	if c.ShutdownTimeout < 0 {
+		return fmt.Errorf("shutdown timeout must not be negative, got %s", c.ShutdownTimeout)
+	}
+	if c.RateTolerance < 0 || c.RateTolerance >= 1 {
+		return fmt.Errorf("rate tolerance must be between 0 and 1, got %f", c.RateTolerance)
+	}
+	if c.MaxWorkers > 0 && c.Workers > c.MaxWorkers {
+		return fmt.Errorf("workers (%d) must not be more than max workers (%d)", c.Workers, c.MaxWorkers)
+	}
+	if c.ResultBuffer < 0 || c.ResultBuffer > MaxResultBuffer {
+		return fmt.Errorf("result buffer must be between 0 and %d, got %d", MaxResultBuffer, c.ResultBuffer)
+	}
+	if err := c.Thresholds.validate(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// AttackName returns Name or the default AttackName
+func (c Config) AttackName() string {
+	if c.Name == "" {
+		return AttackName
+	}
+	return c.Name
+}
+
+// RatePerSecond returns Rate converted to requests per second,
+// or the average of Replay or RateSchedule over Duration
+func (c Config) RatePerSecond() float64 {
+	if len(c.Replay) > 0 {
+		return newReplayPacer(c.Replay).meanRate(c.Duration)
+	}
+	if len(c.RateSchedule) > 0 {
+		return newSchedulePacer(c.RateSchedule, c.RateScheduleLoop, c.Duration).meanRate(c.Duration)
+	}
+	return float64(c.Rate) / c.ratePer().Seconds()
+}
+
+func (c Config) ratePer() time.Duration {
+	if c.RatePer == 0 {
+		return time.Second
+	}
+	return c.RatePer
+}
+
+// checksBody is false for methods without a response body, see expectsBody
+func (c Config) checksBody() bool {
+	return c.expectsBody() && (c.SuccessBodyRegex != "" || c.FailureBodyRegex != "")
+}
+
+// expectsBody is false for HEAD, whose responses never have a body, and OPTIONS,
+// whose responses rarely do, so an empty body is not an anomaly for them
+func (c Config) expectsBody() bool {
+	method := c.method()
+	return method != http.MethodHead && method != http.MethodOptions
+}
+
+func (c Config) method() string {
+	if c.Method == "" {
+		return "GET"
+	}
+	return c.Method
+}
+
+// EffectiveMaxWorkers returns MaxWorkers, lowered to fit the open file limit
+// when CapWorkersToFileLimit is set. Zero means unlimited.
+func (c Config) EffectiveMaxWorkers() uint64 {
+	max := c.MaxWorkers
+	if !c.CapWorkersToFileLimit {
+		return max
+	}
+	limit, ok := fileLimit()
+	if !ok || limit <= fileLimitReserve {
+		return max
+	}
+	if capped := limit - fileLimitReserve; max == 0 || capped < max {
+		return capped
+	}
+	return max
+}
+
+func (c Config) minSamples() uint64 {
+	if c.MinSamples == 0 {
+		return DefaultMinSamples
+	}
+	return c.MinSamples
+}
+
+func (c Config) rateTolerance() float64 {
+	if c.RateTolerance == 0 {
+		return DefaultRateTolerance
+	}
+	return c.RateTolerance
+}
+
+// validateIPVersion checks IPVersion and that an IP address host matches it
+func (c Config) validateIPVersion(host string) error {
+	switch c.IPVersion {
+	case "":
+		return nil
+	case "4", "6":
+	default:
+		return fmt.Errorf("IP version must be 4 or 6, got %q", c.IPVersion)
+	}
+	if ip := net.ParseIP(host); ip != nil && (ip.To4() != nil) != (c.IPVersion == "4") {
+		return fmt.Errorf("IP version %s does not match the URI address %s", c.IPVersion, host)
+	}
+	return nil
+}
+
+// network returns the dial network for IPVersion
+func (c Config) network(network string) string {
+	if c.IPVersion != "" && network == "tcp" {
+		return network + c.IPVersion
+	}
+	return network
+}
+
+// validateHeaderSize checks the headers of a request against MaxHeaderCount and
+// MaxHeaderBytes, counting every value as a "Name: value" line
+func (c Config) validateHeaderSize() error {
+	count, size := 0, 0
+	for name, values := range c.header() {
+		for _, value := range values {
+			count++
+			size += len(name) + len(value) + len(": \r\n")
+		}
+	}
+	if c.ChaosHeader.isSet() {
+		longest := 0
+		for _, value := range c.ChaosHeader.Values {
+			longest = max(longest, len(value))
+		}
+		count++
+		size += len(c.ChaosHeader.Name) + longest + len(": \r\n")
+	}
+	if count > MaxHeaderCount {
+		return fmt.Errorf("too many headers, at most %d, got %d", MaxHeaderCount, count)
+	}
+	if size > MaxHeaderBytes {
+		return fmt.Errorf("headers too large, at most %d bytes, got %d", MaxHeaderBytes, size)
+	}
+	return nil
+}
+
+// header returns Header with HostHeader set as Host, which Vegeta sends as the request host,
+// and DefaultContentType set when there is a body without a Content-Type
+func (c Config) header() http.Header {
+	setContentType := c.DefaultContentType != "" && (len(c.Body) > 0 || len(c.BodyPool) > 0 || c.BodyFile != "") &&
+		c.Header.Get("Content-Type") == ""
+	if c.HostHeader == "" && !setContentType {
+		return c.Header
+	}
+	header := c.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	if c.HostHeader != "" {
+		header.Set("Host", c.HostHeader)
+	}
+	if setContentType {
+		header.Set("Content-Type", c.DefaultContentType)
+	}
+	return header
+}
+
+// maxIdleConnsPerHost returns the configured value or Vegeta's default
+func (c Config) maxIdleConnsPerHost() int {
+	if c.MaxIdleConnsPerHost == 0 {
+		return vegeta.DefaultConnections
+	}
+	return c.MaxIdleConnsPerHost
+}
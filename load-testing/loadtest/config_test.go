@@ -0,0 +1,67 @@
+package loadtest
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+func TestDefaultContentType(t *testing.T) {
+	form, formType := FormBody(url.Values{"name": {"value"}})
+	multipartBody, multipartType, err := MultipartBody(url.Values{"name": {"value"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name     string
+		body     []byte
+		bodyPool [][]byte
+		header   http.Header
+		want     string
+	}{
+		{name: "no body", want: ""},
+		{name: "body", body: []byte(`{}`), want: "application/json"},
+		{name: "body pool", bodyPool: [][]byte{[]byte(`{}`), []byte(`[]`)}, want: "application/json"},
+		{name: "explicit header", body: []byte(`{}`), header: http.Header{"Content-Type": {"text/plain"}}, want: "text/plain"},
+		// The -form and -multipart-* flags set the header the way cmd/load-test does
+		{name: "form", body: form, header: http.Header{"Content-Type": {formType}}, want: formType},
+		{name: "multipart", body: multipartBody, header: http.Header{"Content-Type": {multipartType}}, want: multipartType},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := Config{
+				URI:                "http://localhost/",
+				Method:             "POST",
+				Body:               test.body,
+				BodyPool:           test.bodyPool,
+				Header:             test.header,
+				DefaultContentType: "application/json",
+				Rate:               1,
+				Duration:           time.Second,
+				Timeout:            time.Second,
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			before := test.header.Clone()
+			targeter := NewTargeter(cfg)
+			var tgt vegeta.Target
+			if err := targeter(&tgt); err != nil {
+				t.Fatal(err)
+			}
+			if got := tgt.Header.Get("Content-Type"); got != test.want {
+				t.Errorf("Content-Type %q, want %q", got, test.want)
+			}
+			if !reflect.DeepEqual(cfg.Header, before) {
+				t.Errorf("Header changed to %v, want %v", cfg.Header, before)
+			}
+		})
+	}
+	if !strings.HasPrefix(multipartType, "multipart/form-data; boundary=") {
+		t.Errorf("multipart Content-Type %q has no boundary", multipartType)
+	}
+}
@@ -0,0 +1,51 @@
+package loadtest
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// dialFunc is the signature of http.Transport.DialContext
+type dialFunc func(ctx context.Context, network string, addr string) (net.Conn, error)
+
+// connLimiter caps the connections open to all hosts together, for
+// Config.MaxTotalConns. http.Transport only has a limit per host.
+type connLimiter struct {
+	slots chan struct{}
+}
+
+func newConnLimiter(limit int) *connLimiter {
+	return &connLimiter{slots: make(chan struct{}, limit)}
+}
+
+// dial waits for a free slot before dialing, or until ctx is done.
+// The slot is freed when the connection is closed.
+func (l *connLimiter) dial(next dialFunc) dialFunc {
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		conn, err := next(ctx, network, addr)
+		if err != nil {
+			<-l.slots
+			return nil, err
+		}
+		return &limitedConn{Conn: conn, release: func() { <-l.slots }}, nil
+	}
+}
+
+// limitedConn frees its connLimiter slot on the first Close
+type limitedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
@@ -0,0 +1,99 @@
+package loadtest
+
+import (
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/influxdata/tdigest"
+)
+
+// MinConnWait is the shortest wait for a connection counted in ConnWaitResults.Waited,
+// taking an idle connection from the pool takes microseconds
+const MinConnWait time.Duration = time.Millisecond
+
+// ConnWaitResults shows how long requests waited for a connection from the pool
+// before being sent, which adds to their latency without the target being slow.
+// Requests on a new connection only count the time until dialing started,
+// the dial itself is in LatencyBreakdownResults.
+type ConnWaitResults struct {
+	Requests uint64        `json:"requests"` // Requests that got a connection
+	Waited   uint64        `json:"waited"`   // Requests that waited MinConnWait or longer
+	Total    time.Duration `json:"total"`    // Time all requests spent waiting
+	Wait     PhaseLatency  `json:"wait"`     // Distribution of the waits of the Waited requests
+}
+
+// connWaitRecorder collects the waits of every worker
+type connWaitRecorder struct {
+	mu       sync.Mutex
+	requests uint64
+	total    time.Duration
+	waited   phaseDurations
+}
+
+func newConnWaitRecorder() *connWaitRecorder {
+	return &connWaitRecorder{waited: phaseDurations{digest: tdigest.NewWithCompression(100)}}
+}
+
+func (r *connWaitRecorder) add(wait time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests++
+	r.total += wait
+	if wait < MinConnWait {
+		return
+	}
+	r.waited.samples++
+	r.waited.total += wait
+	r.waited.max = max(r.waited.max, wait)
+	r.waited.digest.Add(float64(wait), 1)
+}
+
+func (r *connWaitRecorder) summary() *ConnWaitResults {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &ConnWaitResults{Requests: r.requests, Waited: r.waited.samples, Total: r.total, Wait: r.waited.summary()}
+}
+
+// connWaitTransport records how long every request waited for a connection:
+// from asking the pool until it got one, or until it started dialing a new one
+type connWaitTransport struct {
+	recorder *connWaitRecorder
+	next     http.RoundTripper
+}
+
+func (t *connWaitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Dialing may try several addresses at once, so the times are guarded
+	var mu sync.Mutex
+	var getConn, dialStart time.Time
+	dialing := func() {
+		mu.Lock()
+		if dialStart.IsZero() {
+			dialStart = time.Now()
+		}
+		mu.Unlock()
+	}
+	trace := &httptrace.ClientTrace{
+		GetConn: func(string) {
+			mu.Lock()
+			getConn = time.Now()
+			mu.Unlock()
+		},
+		DNSStart:     func(httptrace.DNSStartInfo) { dialing() },
+		ConnectStart: func(string, string) { dialing() },
+		GotConn: func(info httptrace.GotConnInfo) {
+			mu.Lock()
+			end := time.Now()
+			if !info.Reused && !dialStart.IsZero() {
+				end = dialStart
+			}
+			start := getConn
+			mu.Unlock()
+			if !start.IsZero() {
+				t.recorder.add(max(0, end.Sub(start)))
+			}
+		},
+	}
+	return t.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
@@ -0,0 +1,21 @@
+package loadtest
+
+import (
+	"strings"
+	"syscall"
+)
+
+// fileLimitReserve is kept free for stdout, output files, DNS lookups, etc.
+// when capping workers to the open file limit
+const fileLimitReserve uint64 = 64
+
+// IsFileLimitError reports whether a result error was caused by running out of file descriptors
+func IsFileLimitError(err string) bool {
+	return strings.Contains(err, syscall.EMFILE.Error()) || strings.Contains(err, syscall.ENFILE.Error())
+}
+
+// FileLimit returns the soft limit of open files for this process.
+// The second value is false when the limit is unknown (Windows).
+func FileLimit() (uint64, bool) {
+	return fileLimit()
+}
@@ -0,0 +1,7 @@
+//go:build !unix
+
+package loadtest
+
+func fileLimit() (uint64, bool) {
+	return 0, false
+}
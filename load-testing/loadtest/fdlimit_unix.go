@@ -0,0 +1,15 @@
+//go:build unix
+
+package loadtest
+
+import (
+	"syscall"
+)
+
+func fileLimit() (uint64, bool) {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return 0, false
+	}
+	return uint64(limit.Cur), true
+}
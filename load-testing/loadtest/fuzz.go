@@ -0,0 +1,104 @@
+package loadtest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+// Fuzz modes, see malformed
+const (
+	FuzzTruncate  string = "truncate"
+	FuzzDuplicate string = "duplicate"
+	FuzzCorrupt   string = "corrupt"
+)
+
+// fuzzFragment marks the URL of a fuzzed request with its mode. Fragments are
+// never sent, but vegeta.Result keeps the URL, so results can tell them apart.
+const fuzzFragment string = "#fuzz="
+
+// FuzzConfig sends a fraction of the requests with a malformed body, to test
+// the target's validation under load. 4xx responses to them are the expected
+// rejections and not failures, see Results.Fuzz. The zero value sends none.
+type FuzzConfig struct {
+	Mode string  // FuzzTruncate, FuzzDuplicate or FuzzCorrupt
+	Rate float64 // Fraction of requests with a body that are malformed, between 0 and 1
+}
+
+func (f FuzzConfig) isSet() bool {
+	return f.Rate > 0
+}
+
+func (f FuzzConfig) validate() error {
+	if f.Rate < 0 || f.Rate > 1 {
+		return fmt.Errorf("fuzz rate must be between 0 and 1, got %g", f.Rate)
+	}
+	if !f.isSet() {
+		return nil
+	}
+	switch f.Mode {
+	case FuzzTruncate, FuzzDuplicate, FuzzCorrupt:
+		return nil
+	case "":
+		return errors.New("fuzz needs a mode")
+	}
+	return fmt.Errorf("fuzz mode must be %s, %s or %s, got %q", FuzzTruncate, FuzzDuplicate, FuzzCorrupt, f.Mode)
+}
+
+// FuzzResults counts the outcomes of the malformed requests of Config.Fuzz.
+// Rejected are not in Results.Failures, the rest are counted like any request:
+// Accepted got a 2xx or 3xx, the target did not notice, and Failed got a 5xx,
+// a 429 or an error, the target broke instead of rejecting the body.
+type FuzzResults struct {
+	Mode     string  `json:"mode"`
+	Rate     float64 `json:"rate"`
+	Requests uint64  `json:"requests"`
+	Rejected uint64  `json:"rejected"`
+	Accepted uint64  `json:"accepted"`
+	Failed   uint64  `json:"failed"`
+}
+
+// malformed returns a broken copy of body: truncate cuts it off at a random
+// byte, duplicate sends it twice and corrupt changes one random byte in every
+// 64, at least one. body must not be empty.
+func malformed(body []byte, mode string) []byte {
+	switch mode {
+	case FuzzTruncate:
+		return bytes.Clone(body[:rand.IntN(len(body))])
+	case FuzzDuplicate:
+		return bytes.Repeat(body, 2)
+	case FuzzCorrupt:
+		corrupted := bytes.Clone(body)
+		for range max(1, len(body)/64) {
+			// XOR with a non-zero byte always changes it
+			corrupted[rand.IntN(len(corrupted))] ^= byte(1 + rand.IntN(255))
+		}
+		return corrupted
+	}
+	return body
+}
+
+// fuzzTargeter replaces the body of a Config.Fuzz Rate of the targets with a
+// malformed one and marks their URL with fuzzFragment. Targets without a body are sent as they are.
+func fuzzTargeter(targeter vegeta.Targeter, fuzz FuzzConfig) vegeta.Targeter {
+	return func(tgt *vegeta.Target) error {
+		if err := targeter(tgt); err != nil {
+			return err
+		}
+		if len(tgt.Body) == 0 || rand.Float64() >= fuzz.Rate {
+			return nil
+		}
+		tgt.Body = malformed(tgt.Body, fuzz.Mode)
+		tgt.URL += fuzzFragment + fuzz.Mode
+		return nil
+	}
+}
+
+// isFuzzed reports whether res is for a request malformed by fuzzTargeter
+func isFuzzed(res *vegeta.Result) bool {
+	return strings.Contains(res.URL, fuzzFragment)
+}
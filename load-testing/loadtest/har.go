@@ -0,0 +1,213 @@
+package loadtest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+// MaxHARSize caps the size of a HAR file, browser sessions with large responses
+// are mostly response content that is not replayed
+const MaxHARSize int64 = 64 * 1024 * 1024
+
+// ReplayRequest is one request of Config.Replay, sent At after the attack began
+type ReplayRequest struct {
+	At     time.Duration
+	Method string
+	URL    string
+	Header http.Header
+	Body   []byte
+}
+
+// harSkippedHeaders are recomputed by the client or describe the browser's
+// connection rather than the request
+var harSkippedHeaders = map[string]bool{
+	"Host":              true,
+	"Content-Length":    true,
+	"Connection":        true,
+	"Keep-Alive":        true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+	"Te":                true,
+}
+
+// har holds the parts of a HAR 1.2 archive that are replayed
+type har struct {
+	Log struct {
+		Entries []struct {
+			StartedDateTime time.Time `json:"startedDateTime"`
+			Request         struct {
+				Method  string `json:"method"`
+				URL     string `json:"url"`
+				Headers []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+				PostData *struct {
+					MimeType string `json:"mimeType"`
+					Text     string `json:"text"`
+					Params   []struct {
+						Name  string `json:"name"`
+						Value string `json:"value"`
+					} `json:"params"`
+				} `json:"postData"`
+			} `json:"request"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// ParseHAR reads the requests of a HAR archive, exported from the network tab
+// of a browser, in the order they were started. At keeps the time between them.
+// HTTP/2 pseudo headers and headers about the connection are left out.
+func ParseHAR(data []byte) ([]ReplayRequest, error) {
+	var archive har
+	if err := json.Unmarshal(data, &archive); err != nil {
+		return nil, err
+	}
+	entries := archive.Log.Entries
+	if len(entries) == 0 {
+		return nil, errors.New("no entries")
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].StartedDateTime.Before(entries[j].StartedDateTime)
+	})
+	began := entries[0].StartedDateTime
+	requests := make([]ReplayRequest, len(entries))
+	for i, entry := range entries {
+		req := ReplayRequest{
+			At:     entry.StartedDateTime.Sub(began),
+			Method: entry.Request.Method,
+			URL:    entry.Request.URL,
+			Header: http.Header{},
+		}
+		for _, header := range entry.Request.Headers {
+			name := http.CanonicalHeaderKey(header.Name)
+			if strings.HasPrefix(name, ":") || harSkippedHeaders[name] {
+				continue
+			}
+			req.Header.Add(name, header.Value)
+		}
+		if postData := entry.Request.PostData; postData != nil {
+			if postData.Text != "" {
+				req.Body = []byte(postData.Text)
+			} else if len(postData.Params) > 0 {
+				// Browsers may record form fields only as params
+				values := url.Values{}
+				for _, param := range postData.Params {
+					values.Add(param.Name, param.Value)
+				}
+				req.Body = []byte(values.Encode())
+			}
+			if req.Header.Get("Content-Type") == "" && postData.MimeType != "" && len(req.Body) > 0 {
+				req.Header.Set("Content-Type", postData.MimeType)
+			}
+		}
+		requests[i] = req
+	}
+	return requests, nil
+}
+
+// validateReplay checks every request goes to the scheme, host and port of the URI,
+// so a HAR file of a whole browsing session cannot attack third parties or other
+// services on the target's host
+func validateReplay(replay []ReplayRequest, target *url.URL) error {
+	for i, req := range replay {
+		u, err := url.Parse(req.URL)
+		if err != nil {
+			return fmt.Errorf("replay request %d: invalid URL: %w", i+1, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("replay request %d: scheme must be http or https, got %q", i+1, u.Scheme)
+		}
+		if origin(u) != origin(target) {
+			return fmt.Errorf("replay request %d: must be on the target %s, got %s", i+1, origin(target), origin(u))
+		}
+		if req.Method == "" {
+			return fmt.Errorf("replay request %d: missing method", i+1)
+		}
+		if req.At < 0 || (i > 0 && req.At < replay[i-1].At) {
+			return fmt.Errorf("replay request %d: must not be sent before the previous one", i+1)
+		}
+	}
+	return nil
+}
+
+// origin returns the scheme and host:port of u, with the scheme's default port
+// filled in so http://example.com and http://example.com:80 are the same
+func origin(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+	return u.Scheme + "://" + net.JoinHostPort(strings.ToLower(u.Hostname()), port)
+}
+
+// replayTargeter sends the requests of Config.Replay in order. Header and
+// HostHeader are added to the recorded headers, recorded values win.
+func replayTargeter(cfg Config) vegeta.Targeter {
+	header := cfg.header()
+	targets := make([]vegeta.Target, len(cfg.Replay))
+	for i, req := range cfg.Replay {
+		merged := req.Header.Clone()
+		if merged == nil {
+			merged = http.Header{}
+		}
+		for name, values := range header {
+			if _, ok := merged[name]; !ok {
+				merged[name] = values
+			}
+		}
+		if cfg.DefaultContentType != "" && len(req.Body) > 0 && merged.Get("Content-Type") == "" {
+			merged.Set("Content-Type", cfg.DefaultContentType)
+		}
+		targets[i] = vegeta.Target{Method: req.Method, URL: req.URL, Body: req.Body, Header: merged}
+	}
+	return vegeta.NewStaticTargeter(targets...)
+}
+
+// replayPacer sends hit n at at[n] and stops after the last one
+type replayPacer struct {
+	at []time.Duration
+}
+
+func newReplayPacer(replay []ReplayRequest) *replayPacer {
+	at := make([]time.Duration, len(replay))
+	for i, req := range replay {
+		at[i] = req.At
+	}
+	return &replayPacer{at: at}
+}
+
+// Pace implements vegeta.Pacer
+func (p *replayPacer) Pace(elapsed time.Duration, hits uint64) (time.Duration, bool) {
+	if hits >= uint64(len(p.at)) {
+		return 0, true
+	}
+	if due := p.at[hits]; due > elapsed {
+		return due - elapsed, false
+	}
+	return 0, false
+}
+
+// Rate implements vegeta.Pacer, the requests due in the second elapsed is in
+func (p *replayPacer) Rate(elapsed time.Duration) float64 {
+	start := elapsed.Truncate(time.Second)
+	from := sort.Search(len(p.at), func(i int) bool { return p.at[i] >= start })
+	to := sort.Search(len(p.at), func(i int) bool { return p.at[i] >= start+time.Second })
+	return float64(to - from)
+}
+
+// meanRate returns the requests per second over d, or over the replay when it ends first
+func (p *replayPacer) meanRate(d time.Duration) float64 {
+	sent := sort.Search(len(p.at), func(i int) bool { return p.at[i] >= d })
+	span := min(d, (p.at[len(p.at)-1] + time.Second).Truncate(time.Second))
+	return float64(sent) / span.Seconds()
+}
@@ -0,0 +1,67 @@
+package loadtest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReplayRawURL(t *testing.T) {
+	var mu sync.Mutex
+	paths := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths[r.RequestURI]++
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	// Go escapes the ü, raw mode sends each request's path as recorded instead of the URI's
+	cfg := Config{
+		URI: server.URL + "/start",
+		Replay: []ReplayRequest{
+			{Method: "GET", URL: server.URL + "/ü"},
+			{At: 100 * time.Millisecond, Method: "GET", URL: server.URL + "/é?page=2"},
+		},
+		RawURL:   true,
+		Duration: 5 * time.Second,
+		Timeout:  5 * time.Second,
+	}
+	results, err := RunContext(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.Requests != 2 || results.Failures != 0 {
+		t.Fatalf("%d requests, %d failures, want 2 and no failures", results.Requests, results.Failures)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if paths["/ü"] != 1 || paths["/é?page=2"] != 1 || len(paths) != 2 {
+		t.Errorf("paths seen %v, want /ü and /é?page=2 once each", paths)
+	}
+}
+
+func TestValidateReplayOrigin(t *testing.T) {
+	target, err := url.Parse("https://example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for uri, valid := range map[string]bool{
+		"https://example.com/a":     true,
+		"https://EXAMPLE.com:443/a": true,
+		"http://example.com/a":      false,
+		"https://example.com:8443/": false,
+		"https://other.com/a":       false,
+	} {
+		err := validateReplay([]ReplayRequest{{Method: "GET", URL: uri}}, target)
+		if valid && err != nil {
+			t.Errorf("%s: %v, want it valid", uri, err)
+		} else if !valid && err == nil {
+			t.Errorf("%s is valid, want an error", uri)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package loadtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// MaxHeadersFileSize caps the size of a headers file, a few long JWTs fit easily
+const MaxHeadersFileSize int64 = 64 * 1024
+
+// ParseHeaders reads headers from either a JSON object of strings
+//
+//	{"Authorization": "Bearer TOKEN"}
+//
+// or one "Name: value" per line, skipping blank lines and lines starting with #
+func ParseHeaders(data []byte) (http.Header, error) {
+	header := http.Header{}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		values := map[string]string{}
+		if err := json.Unmarshal(trimmed, &values); err != nil {
+			return nil, fmt.Errorf("invalid JSON headers: %w", err)
+		}
+		for name, value := range values {
+			if err := addHeader(header, name, value); err != nil {
+				return nil, err
+			}
+		}
+		return header, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(text, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"Name: value\"", line)
+		}
+		if err := addHeader(header, strings.TrimSpace(name), strings.TrimSpace(value)); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+func addHeader(header http.Header, name string, value string) error {
+	if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+		return fmt.Errorf("invalid header name %q", name)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("header %s: value must not contain line breaks", name)
+	}
+	header.Add(name, value)
+	return nil
+}
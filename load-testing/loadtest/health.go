@@ -0,0 +1,66 @@
+package loadtest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// CheckHealth sends one GET to uri with the connection and TLS settings of cfg
+// and fails unless the response has expectedStatus, so an attack against a
+// target that is down fails fast. uri must be on the same host as cfg.URI.
+func CheckHealth(cfg Config, uri string, expectedStatus int) error {
+	target, err := url.Parse(cfg.URI)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https, got %q", u.Scheme)
+	}
+	if u.Hostname() != target.Hostname() {
+		return fmt.Errorf("host must be the target's host %s, got %q", target.Hostname(), u.Hostname())
+	}
+	if expectedStatus < 100 || expectedStatus > 599 {
+		return fmt.Errorf("expected status must be between 100 and 599, got %d", expectedStatus)
+	}
+
+	// Only the connection settings matter, the body file, simulation and tracing are left out
+	probe := cfg
+	probe.BodyFile = ""
+	probe.RawURL = false
+	probe.NetworkSim = NetworkSimConfig{}
+	probe.MeasureTLSHandshake = false
+	probe.MeasureLatencyBreakdown = false
+	probe.MeasureConnWait = false
+	client := newClient(probe, nil, nil, nil)
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return err
+	}
+	if cfg.Header != nil {
+		req.Header = cfg.Header.Clone()
+	}
+	if cfg.HostHeader != "" {
+		req.Host = cfg.HostHeader
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("%s is unreachable: %w", uri, err)
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, int64(MaxBodyMatchBytes)))
+	if res.StatusCode != expectedStatus {
+		return fmt.Errorf("%s responded %s, expected %d", uri, res.Status, expectedStatus)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package loadtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckHealthTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	// The self-signed certificate is accepted like in the attack, with or without TLS options
+	for _, cfg := range []Config{
+		{URI: server.URL + "/"},
+		{URI: server.URL + "/", TLS: TLSConfig{MinVersion: "1.2"}},
+	} {
+		if err := CheckHealth(cfg, server.URL+"/health", http.StatusOK); err != nil {
+			t.Errorf("TLS %+v: %v", cfg.TLS, err)
+		}
+	}
+	if err := CheckHealth(Config{URI: server.URL + "/"}, server.URL+"/missing", http.StatusOK); err == nil {
+		t.Error("404 passed the health check, want an error")
+	}
+}
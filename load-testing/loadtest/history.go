@@ -0,0 +1,86 @@
+package loadtest
+
+import (
+	"math"
+	"time"
+)
+
+// MinHistoryRuns is the fewest previous runs CompareHistory needs,
+// the standard deviation of fewer says little about the noise
+const MinHistoryRuns int = 3
+
+// MinHistoryChange is the smallest change from the mean, as a fraction of it,
+// CompareHistory flags. Nearly identical runs have a standard deviation so small
+// that a few percent of noise would be more than Sigmas of them.
+const MinHistoryChange float64 = 0.05
+
+// HistoryRun is what is kept of a run to compare later runs against,
+// latencies in milliseconds so the files do not depend on Config.LatencyUnit
+type HistoryRun struct {
+	Time     time.Time `json:"time"`
+	Requests uint64    `json:"requests"`
+	P50      float64   `json:"p50Ms"`
+	P95      float64   `json:"p95Ms"`
+	P99      float64   `json:"p99Ms"`
+}
+
+// NewHistoryRun returns the part of results kept in the history
+func NewHistoryRun(results Results, at time.Time) HistoryRun {
+	ms := results.Latencies.Milliseconds()
+	return HistoryRun{Time: at, Requests: results.Requests, P50: ms.P50, P95: ms.P95, P99: ms.P99}
+}
+
+// HistoryComparison compares one percentile of a run to previous runs.
+// Regressed is set when Current is above Limit, Sigmas standard deviations
+// above the mean and at least MinHistoryChange above it. Latencies are in milliseconds.
+type HistoryComparison struct {
+	Percentile string  `json:"percentile"`
+	Current    float64 `json:"current"`
+	Mean       float64 `json:"mean"`
+	StdDev     float64 `json:"stdDev"`
+	Limit      float64 `json:"limit"`
+	Runs       int     `json:"runs"`
+	Regressed  bool    `json:"regressed"`
+}
+
+// CompareHistory compares the p50, p95 and p99 of current to the runs in history,
+// so only a change larger than the usual run to run noise is a regression.
+// Faster runs never regress. Nil with fewer than MinHistoryRuns runs.
+func CompareHistory(current HistoryRun, history []HistoryRun, sigmas float64) []HistoryComparison {
+	if len(history) < MinHistoryRuns {
+		return nil
+	}
+	percentiles := []struct {
+		name  string
+		value func(HistoryRun) float64
+	}{
+		{"p50", func(r HistoryRun) float64 { return r.P50 }},
+		{"p95", func(r HistoryRun) float64 { return r.P95 }},
+		{"p99", func(r HistoryRun) float64 { return r.P99 }},
+	}
+	comparisons := make([]HistoryComparison, len(percentiles))
+	for i, p := range percentiles {
+		var sum float64
+		for _, run := range history {
+			sum += p.value(run)
+		}
+		mean := sum / float64(len(history))
+		var squares float64
+		for _, run := range history {
+			squares += (p.value(run) - mean) * (p.value(run) - mean)
+		}
+		// Sample standard deviation, the history is a sample of possible runs
+		stdDev := math.Sqrt(squares / float64(len(history)-1))
+		limit := mean + max(sigmas*stdDev, MinHistoryChange*mean)
+		comparisons[i] = HistoryComparison{
+			Percentile: p.name,
+			Current:    p.value(current),
+			Mean:       mean,
+			StdDev:     stdDev,
+			Limit:      limit,
+			Runs:       len(history),
+			Regressed:  p.value(current) > limit,
+		}
+	}
+	return comparisons
+}
@@ -0,0 +1,122 @@
+package loadtest
+
+import (
+	"encoding/json"
+)
+
+// MarshalJSON writes durations as strings like "12.3ms" instead of nanoseconds,
+// or as numbers in the unit of Config.LatencyUnit
+func (l LatencyResults) MarshalJSON() ([]byte, error) {
+	switch l.unit {
+	case LatencyUnitMs:
+		ms := l.Milliseconds()
+		return json.Marshal(struct {
+			LatencyMsResults
+			Samples  uint64 `json:"samples"`
+			Reliable bool   `json:"reliable"`
+		}{ms, l.Samples, l.Reliable})
+	case LatencyUnitNs:
+		// latencies has the same fields without the MarshalJSON method
+		type latencies LatencyResults
+		return json.Marshal(latencies(l))
+	}
+	return json.Marshal(struct {
+		Total string `json:"total"`
+		Mean  string `json:"mean"`
+		Min   string `json:"min"`
+		Max   string `json:"max"`
+		P50   string `json:"p50"`
+		P90   string `json:"p90"`
+		P95   string `json:"p95"`
+		P99   string `json:"p99"`
+		P999  string `json:"p999"`
+		P9999 string `json:"p9999"`
+
+		Samples  uint64 `json:"samples"`
+		Reliable bool   `json:"reliable"`
+	}{
+		l.Total.String(),
+		l.Mean.String(),
+		l.Min.String(),
+		l.Max.String(),
+		l.P50.String(),
+		l.P90.String(),
+		l.P95.String(),
+		l.P99.String(),
+		l.P999.String(),
+		l.P9999.String(),
+		l.Samples,
+		l.Reliable,
+	})
+}
+
+// MarshalJSON writes durations as strings like "10s" instead of nanoseconds
+func (r Results) MarshalJSON() ([]byte, error) {
+	// results has the same fields without the MarshalJSON method,
+	// the string fields below take precedence over the embedded ones
+	type results Results
+	return json.Marshal(struct {
+		results
+		Duration string `json:"duration"`
+		Wait     string `json:"wait"`
+		Paused   string `json:"paused"`
+	}{results(r), r.Duration.String(), r.Wait.String(), r.Paused.String()})
+}
+
+// MarshalJSON writes durations as strings like "12.3ms" instead of nanoseconds
+func (p PercentileSpread) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Min    string `json:"min"`
+		Median string `json:"median"`
+		Max    string `json:"max"`
+	}{p.Min.String(), p.Median.String(), p.Max.String()})
+}
+
+// MarshalJSON writes durations as strings like "12.3ms" instead of nanoseconds
+func (p PhaseLatency) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Samples uint64 `json:"samples"`
+		Mean    string `json:"mean"`
+		P50     string `json:"p50"`
+		P90     string `json:"p90"`
+		P99     string `json:"p99"`
+		Max     string `json:"max"`
+	}{p.Samples, p.Mean.String(), p.P50.String(), p.P90.String(), p.P99.String(), p.Max.String()})
+}
+
+// MarshalJSON writes durations as strings like "12.3ms" instead of nanoseconds
+func (a Alert) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		At        string `json:"at"`
+		P99       string `json:"p99"`
+		Threshold string `json:"threshold"`
+		Window    string `json:"window"`
+		Requests  uint64 `json:"requests"`
+	}{a.At.String(), a.P99.String(), a.Threshold.String(), a.Window.String(), a.Requests})
+}
+
+// MarshalJSON writes durations as strings like "12.3ms" instead of nanoseconds
+func (g GeneratorStats) MarshalJSON() ([]byte, error) {
+	// stats has the same fields without the MarshalJSON method,
+	// the string field below takes precedence over the embedded one
+	type stats GeneratorStats
+	return json.Marshal(struct {
+		stats
+		CPUTime string `json:"cpuTime"`
+	}{stats(g), g.CPUTime.String()})
+}
+
+// MarshalJSON writes durations as strings like "12.3ms" instead of nanoseconds
+func (t TLSHandshakeResults) MarshalJSON() ([]byte, error) {
+	// handshakes has the same fields without the MarshalJSON method,
+	// the string fields below take precedence over the embedded ones
+	type handshakes TLSHandshakeResults
+	return json.Marshal(struct {
+		handshakes
+		Mean string `json:"mean"`
+		P50  string `json:"p50"`
+		P90  string `json:"p90"`
+		P99  string `json:"p99"`
+		Max  string `json:"max"`
+	}{handshakes(t), t.Mean.String(), t.P50.String(), t.P90.String(), t.P99.String(), t.Max.String()})
+}
@@ -0,0 +1,65 @@
+package loadtest
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// errSimulatedDrop is returned for requests dropped by NetworkSimConfig.DropRate
+var errSimulatedDrop = errors.New(simulatedErrorMarker + ": request dropped")
+
+// simulatedErrorMarker is in the text of every simulated error so they are never
+// mistaken for real failures
+const simulatedErrorMarker string = "simulated network error"
+
+// NetworkSimConfig degrades the network on the generator side, to test how
+// clients of the target behave. Zero values are not simulated.
+type NetworkSimConfig struct {
+	ExtraLatency time.Duration // Added before every request is sent
+	DropRate     float64       // Fraction of requests failed with a simulated error instead of being sent
+}
+
+func (n NetworkSimConfig) validate() error {
+	if n.ExtraLatency < 0 {
+		return fmt.Errorf("simulated extra latency must not be negative, got %s", n.ExtraLatency)
+	}
+	if n.DropRate < 0 || n.DropRate > 1 {
+		return fmt.Errorf("simulated drop rate must be between 0 and 1, got %f", n.DropRate)
+	}
+	return nil
+}
+
+func (n NetworkSimConfig) isSet() bool {
+	return n.ExtraLatency > 0 || n.DropRate > 0
+}
+
+// IsSimulatedError reports whether a result error came from Config.NetworkSim
+func IsSimulatedError(err string) bool {
+	return strings.Contains(err, simulatedErrorMarker)
+}
+
+// simTransport applies a NetworkSimConfig before handing requests to next
+type simTransport struct {
+	sim  NetworkSimConfig
+	next http.RoundTripper
+}
+
+func (t *simTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.sim.ExtraLatency > 0 {
+		timer := time.NewTimer(t.sim.ExtraLatency)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+	if t.sim.DropRate > 0 && rand.Float64() < t.sim.DropRate {
+		return nil, errSimulatedDrop
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,161 @@
+package loadtest
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+// backoffPacer wraps a pacer so the attack can be paused when the target
+// sends Retry-After, or held until resumed through Config.Pauses.
+// Time spent paused is hidden from the wrapped pacer,
+// so it resumes at the configured rate instead of bursting to catch up.
+type backoffPacer struct {
+	pacer vegeta.Pacer
+
+	mu          sync.Mutex
+	until       time.Time     // Paused until
+	pausedSince time.Time     // Start of the current pause, zero when not paused
+	paused      time.Duration // Total time spent in finished pauses
+
+	held      bool          // Held until resume is called
+	heldSince time.Time     // Start of the current hold
+	heldFor   time.Duration // Total time spent in finished holds
+	resumed   chan struct{} // Closed by resume
+	stopped   bool          // Set by stop, ends the attack
+}
+
+// Pace implements vegeta.Pacer. While held it blocks, Vegeta sends a hit
+// after every wait so returning a wait would leak requests.
+func (p *backoffPacer) Pace(elapsed time.Duration, hits uint64) (time.Duration, bool) {
+	p.mu.Lock()
+	for p.held {
+		resumed := p.resumed
+		p.mu.Unlock()
+		blocked := time.Now()
+		<-resumed
+		// elapsed was measured before blocking
+		elapsed += time.Since(blocked)
+		p.mu.Lock()
+	}
+	if p.stopped {
+		p.mu.Unlock()
+		return 0, true
+	}
+	now := time.Now()
+	if now.Before(p.until) {
+		p.mu.Unlock()
+		return p.until.Sub(now), false
+	}
+	if !p.pausedSince.IsZero() {
+		p.paused += p.until.Sub(p.pausedSince)
+		p.pausedSince = time.Time{}
+	}
+	paused := p.paused
+	p.mu.Unlock()
+	return p.pacer.Pace(elapsed-paused, hits)
+}
+
+// Rate implements vegeta.Pacer
+func (p *backoffPacer) Rate(elapsed time.Duration) float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.held || time.Now().Before(p.until) {
+		return 0
+	}
+	return p.pacer.Rate(elapsed - p.paused)
+}
+
+// pause stops new requests for d, extending any pause already in progress
+func (p *backoffPacer) pause(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if !p.held && !p.pausedSince.IsZero() && !now.Before(p.until) {
+		// The previous pause is over but Pace has not accounted for it yet
+		p.paused += p.until.Sub(p.pausedSince)
+		p.pausedSince = time.Time{}
+	}
+	if p.pausedSince.IsZero() {
+		p.pausedSince = now
+	}
+	if until := now.Add(d); until.After(p.until) {
+		p.until = until
+	}
+}
+
+// hold stops new requests until resume is called
+func (p *backoffPacer) hold() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.held {
+		return
+	}
+	now := time.Now()
+	p.held = true
+	p.heldSince = now
+	p.resumed = make(chan struct{})
+	if p.pausedSince.IsZero() {
+		p.pausedSince = now
+	}
+}
+
+// resume ends a hold, a Retry-After pause still in progress continues
+func (p *backoffPacer) resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.held {
+		return
+	}
+	now := time.Now()
+	p.held = false
+	p.heldFor += now.Sub(p.heldSince)
+	close(p.resumed)
+	if p.until.Before(now) {
+		p.until = now
+	}
+}
+
+// stop ends the attack, releasing a hold. While held Vegeta cannot check
+// the attack duration, so this is called when it runs out.
+func (p *backoffPacer) stop() {
+	p.mu.Lock()
+	p.stopped = true
+	p.mu.Unlock()
+	p.resume()
+}
+
+// heldTotal returns the time spent held, including a hold in progress
+func (p *backoffPacer) heldTotal() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.held {
+		return p.heldFor + time.Since(p.heldSince)
+	}
+	return p.heldFor
+}
+
+// retryAfter parses the Retry-After header as seconds or an HTTP date,
+// returning zero when it is missing or invalid. The result is capped at max.
+func retryAfter(header http.Header, max time.Duration) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	var d time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		d = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		d = time.Until(date)
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
@@ -0,0 +1,120 @@
+package loadtest
+
+import (
+	"slices"
+	"time"
+
+	"github.com/influxdata/tdigest"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+// RampStage holds the requests sent while the configured rate was in
+// [RateFrom, RateTo), see Config.RampBand
+type RampStage struct {
+	RateFrom float64 `json:"rateFrom"`
+	RateTo   float64 `json:"rateTo"`
+
+	// Seconds is how long the configured rate was in the band,
+	// ConfiguredRate its average over that time
+	Seconds        float64 `json:"seconds"`
+	ConfiguredRate float64 `json:"configuredRate"`
+	AchievedRate   float64 `json:"achievedRate"` // Requests sent per second
+
+	Requests  uint64       `json:"requests"`
+	Errors    uint64       `json:"errors"`
+	ErrorRate float64      `json:"errorRate"`
+	Latencies PhaseLatency `json:"latencies"`
+}
+
+// rampProfile buckets results by the configured rate when they were sent.
+// The rate comes from a pacer of its own, so time held by Config.Pauses or
+// RetryAfter is not hidden from it and shifts the bands of a RateSchedule.
+type rampProfile struct {
+	cfg   Config
+	began time.Time
+	pacer vegeta.Pacer
+	bands map[int]*rampBand
+	last  time.Duration // Latest send time seen, where an interrupted attack ended
+}
+
+type rampBand struct {
+	errors    uint64
+	latencies phaseDurations
+}
+
+func newRampProfile(cfg Config, began time.Time) *rampProfile {
+	return &rampProfile{cfg: cfg, began: began, pacer: NewPacer(cfg), bands: map[int]*rampBand{}}
+}
+
+// band returns the index of the band the configured rate at elapsed is in
+func (p *rampProfile) band(elapsed time.Duration) int {
+	return int(p.pacer.Rate(elapsed) / p.cfg.RampBand)
+}
+
+func (p *rampProfile) add(res *vegeta.Result) {
+	elapsed := res.Timestamp.Sub(p.began)
+	p.last = max(p.last, elapsed)
+	// Rates change on whole seconds, so the start of the second is used
+	index := p.band(elapsed.Truncate(time.Second))
+	band, ok := p.bands[index]
+	if !ok {
+		band = &rampBand{latencies: phaseDurations{digest: tdigest.NewWithCompression(100)}}
+		p.bands[index] = band
+	}
+	// Classified like the accumulator, so the bands add up to Failures
+	if p.cfg.Failed(res) {
+		band.errors++
+	}
+	latencies := &band.latencies
+	latencies.samples++
+	latencies.total += res.Latency
+	latencies.max = max(latencies.max, res.Latency)
+	latencies.digest.Add(float64(res.Latency), 1)
+}
+
+// results returns the bands in order of rate. Seconds are counted from
+// Config.ExcludeFirst to Duration, or to the last request sent when interrupted.
+func (p *rampProfile) results(interrupted bool) []RampStage {
+	end := p.cfg.Duration
+	if interrupted {
+		end = min(end, p.last)
+	}
+	stages := map[int]*RampStage{}
+	for start := p.cfg.ExcludeFirst.Truncate(time.Second); start < end; start += time.Second {
+		seconds := (min(start+time.Second, end) - max(start, p.cfg.ExcludeFirst)).Seconds()
+		index := p.band(start)
+		stage, ok := stages[index]
+		if !ok {
+			stage = &RampStage{RateFrom: float64(index) * p.cfg.RampBand, RateTo: float64(index+1) * p.cfg.RampBand}
+			stages[index] = stage
+		}
+		stage.Seconds += seconds
+		stage.ConfiguredRate += p.pacer.Rate(start) * seconds
+	}
+	for index, band := range p.bands {
+		stage, ok := stages[index]
+		if !ok {
+			// Sent after the end, like the last request of an interrupted attack
+			continue
+		}
+		stage.Requests = band.latencies.samples
+		stage.Errors = band.errors
+		stage.ErrorRate = float64(band.errors) / float64(band.latencies.samples)
+		stage.Latencies = band.latencies.summary()
+	}
+	indexes := make([]int, 0, len(stages))
+	for index := range stages {
+		indexes = append(indexes, index)
+	}
+	slices.Sort(indexes)
+	profile := make([]RampStage, len(indexes))
+	for i, index := range indexes {
+		stage := stages[index]
+		if stage.Seconds > 0 {
+			stage.ConfiguredRate /= stage.Seconds
+			stage.AchievedRate = float64(stage.Requests) / stage.Seconds
+		}
+		profile[i] = *stage
+	}
+	return profile
+}
@@ -0,0 +1,64 @@
+package loadtest
+
+import (
+	"slices"
+	"time"
+)
+
+// StableP99Spread is the largest RepeatResults.P99Spread reported as stable
+const StableP99Spread float64 = 0.1
+
+// PercentileSpread is how one latency percentile varied across repeated runs
+type PercentileSpread struct {
+	Min    time.Duration `json:"min"`
+	Median time.Duration `json:"median"`
+	Max    time.Duration `json:"max"`
+}
+
+// RepeatResults aggregates the latency percentiles of the same load test run several times,
+// one run's p99 is too noisy to tell a regression from chance
+type RepeatResults struct {
+	Runs []Results `json:"runs"`
+
+	P50 PercentileSpread `json:"p50"`
+	P90 PercentileSpread `json:"p90"`
+	P95 PercentileSpread `json:"p95"`
+	P99 PercentileSpread `json:"p99"`
+
+	// P99Spread is (max - min) / median of the p99 across runs,
+	// Stable is set when it is at most StableP99Spread
+	P99Spread float64 `json:"p99Spread"`
+	Stable    bool    `json:"stable"`
+}
+
+// Aggregate computes the spread of the latency percentiles across runs
+func Aggregate(runs []Results) RepeatResults {
+	repeat := RepeatResults{
+		Runs: runs,
+		P50:  spread(runs, func(r Results) time.Duration { return r.Latencies.P50 }),
+		P90:  spread(runs, func(r Results) time.Duration { return r.Latencies.P90 }),
+		P95:  spread(runs, func(r Results) time.Duration { return r.Latencies.P95 }),
+		P99:  spread(runs, func(r Results) time.Duration { return r.Latencies.P99 }),
+	}
+	if repeat.P99.Median > 0 {
+		repeat.P99Spread = float64(repeat.P99.Max-repeat.P99.Min) / float64(repeat.P99.Median)
+	}
+	repeat.Stable = repeat.P99Spread <= StableP99Spread
+	return repeat
+}
+
+func spread(runs []Results, percentile func(Results) time.Duration) PercentileSpread {
+	if len(runs) == 0 {
+		return PercentileSpread{}
+	}
+	values := make([]time.Duration, len(runs))
+	for i, run := range runs {
+		values[i] = percentile(run)
+	}
+	slices.Sort(values)
+	median := values[len(values)/2]
+	if len(values)%2 == 0 {
+		median = (values[len(values)/2-1] + median) / 2
+	}
+	return PercentileSpread{Min: values[0], Median: median, Max: values[len(values)-1]}
+}
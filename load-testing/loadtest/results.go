@@ -0,0 +1,367 @@
+package loadtest
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+// MinSamplesP999 and MinSamplesP9999 leave about 10 samples above p99.9 and p99.99,
+// with fewer those percentiles are little more than the slowest request
+const (
+	MinSamplesP999  uint64 = 10000
+	MinSamplesP9999 uint64 = 100000
+)
+
+// LatencyResults holds the latency distribution of a load test
+type LatencyResults struct {
+	Total time.Duration `json:"total"`
+	Mean  time.Duration `json:"mean"`
+	Min   time.Duration `json:"min"`
+	Max   time.Duration `json:"max"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P95   time.Duration `json:"p95"`
+	P99   time.Duration `json:"p99"`
+	P999  time.Duration `json:"p999"`
+	P9999 time.Duration `json:"p9999"`
+
+	// Samples is the number of latencies the percentiles are computed from.
+	// Reliable is false when that is below Config.MinSamples.
+	Samples  uint64 `json:"samples"`
+	Reliable bool   `json:"reliable"`
+
+	unit string // Config.LatencyUnit, used by MarshalJSON
+}
+
+// Units of the latencies in the JSON results, see Config.LatencyUnit
+const (
+	LatencyUnitString string = "string" // Duration strings like "12.3ms"
+	LatencyUnitMs     string = "ms"     // Float milliseconds like 12.3
+	LatencyUnitNs     string = "ns"     // Integer nanoseconds like 12300000
+)
+
+// LatencyMsResults holds LatencyResults as float milliseconds,
+// for tools that plot the JSON results and cannot parse "12.3ms"
+type LatencyMsResults struct {
+	Total float64 `json:"total"`
+	Mean  float64 `json:"mean"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+	P999  float64 `json:"p999"`
+	P9999 float64 `json:"p9999"`
+}
+
+// Milliseconds returns the latencies as float milliseconds
+func (l LatencyResults) Milliseconds() LatencyMsResults {
+	ms := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+	return LatencyMsResults{
+		Total: ms(l.Total),
+		Mean:  ms(l.Mean),
+		Min:   ms(l.Min),
+		Max:   ms(l.Max),
+		P50:   ms(l.P50),
+		P90:   ms(l.P90),
+		P95:   ms(l.P95),
+		P99:   ms(l.P99),
+		P999:  ms(l.P999),
+		P9999: ms(l.P9999),
+	}
+}
+
+// ResponseSizeResults holds the distribution of response body sizes in bytes,
+// a large Max or P99 next to a small P50 points at unexpectedly large payloads
+type ResponseSizeResults struct {
+	Min  uint64  `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  uint64  `json:"p50"`
+	P99  uint64  `json:"p99"`
+	Max  uint64  `json:"max"`
+}
+
+// MaxRetryAfterSamples caps the distinct Retry-After values kept in RateLimitingResults
+const MaxRetryAfterSamples int = 10
+
+// MaxErrorDetailRequests caps the requests listed for each error in ErrorDetail
+const MaxErrorDetailRequests int = 10
+
+// RateLimitingResults describes the 429 responses of a load test,
+// the first one is usually where the target's rate ceiling was reached
+type RateLimitingResults struct {
+	FirstAt        float64  `json:"firstAt"`        // Seconds since the attack began when the first 429 was sent, 0 without any
+	WithRetryAfter uint64   `json:"withRetryAfter"` // 429 responses with a Retry-After header
+	RetryAfter     []string `json:"retryAfter"`     // The first distinct Retry-After values, up to MaxRetryAfterSamples
+}
+
+// ByteThroughputResults holds bytes per second, over the duration plus the wait
+// for the last response like Results.Throughput
+type ByteThroughputResults struct {
+	In  float64 `json:"in"`  // Response bytes per second
+	Out float64 `json:"out"` // Request bytes per second
+}
+
+// ErrorRateWindow holds the errors of the requests sent during one Config.ErrorWindow
+type ErrorRateWindow struct {
+	Start     float64 `json:"start"` // Seconds since the attack began
+	Requests  uint64  `json:"requests"`
+	Errors    uint64  `json:"errors"`
+	Timeouts  uint64  `json:"timeouts"` // Errors that were timeouts, see IsTimeoutError
+	ErrorRate float64 `json:"errorRate"`
+}
+
+// ErrorDetail links a distinct error to the requests that failed with it
+type ErrorDetail struct {
+	Error string `json:"error"`
+	Count uint64 `json:"count"`
+
+	// Requests holds the sequence numbers of the first MaxErrorDetailRequests
+	// requests with this error, the seq field of -encode output and vegeta dump
+	Requests []uint64 `json:"requests"`
+}
+
+// Results holds the outcome of a load test
+type Results struct {
+	Latencies LatencyResults `json:"latencies"`
+	BytesIn   uint64         `json:"bytesIn"`
+	BytesOut  uint64         `json:"bytesOut"`
+
+	// LatenciesMs is only set with Config.LatenciesMs
+	LatenciesMs *LatencyMsResults `json:"latenciesMs,omitempty"`
+
+	ResponseSizes  ResponseSizeResults   `json:"responseSizes"`
+	ByteThroughput ByteThroughputResults `json:"byteThroughput"`
+
+	Success     float64        `json:"success"`    // Ratio of non-error responses, 1 means every request succeeded
+	Rate        float64        `json:"rate"`       // Requests sent per second
+	Throughput  float64        `json:"throughput"` // Successful requests per second
+	Duration    time.Duration  `json:"duration"`
+	Wait        time.Duration  `json:"wait"`
+	Requests    uint64         `json:"requests"`
+	Failures    uint64         `json:"failures"` // Requests that returned an error, including 4xx/5xx responses
+	StatusCodes map[string]int `json:"statusCodes"`
+	Errors      []string       `json:"errors"`
+	RateLimited uint64         `json:"rateLimited"` // Responses with status 429, also counted in StatusCodes and Errors
+
+	// UnsampledErrors counts failed requests whose error is not in Errors
+	// because Config.MaxErrorSamples distinct errors were already kept
+	UnsampledErrors uint64 `json:"unsampledErrors"`
+
+	// ErrorDetails holds the same errors as Errors, with how many requests
+	// failed with each and which ones
+	ErrorDetails []ErrorDetail `json:"errorDetails"`
+
+	RateLimiting RateLimitingResults `json:"rateLimiting"`
+
+	// ThroughputSeries counts the requests sent in each second of the attack,
+	// showing dips and bursts the overall Rate hides
+	ThroughputSeries []uint64 `json:"throughputSeries"`
+
+	// Timeouts counts failed requests that ran out of time, see IsTimeoutError.
+	// TimeoutSeries counts them per second like ThroughputSeries, by when they were sent.
+	// SoftTimeouts is set with Config.SoftTimeout, then Timeouts are not failures.
+	Timeouts      uint64   `json:"timeouts"`
+	TimeoutSeries []uint64 `json:"timeoutSeries"`
+	SoftTimeouts  bool     `json:"softTimeouts"`
+
+	// Fuzz is only set with Config.Fuzz. Its rejected requests are left out of
+	// Failures, Errors and ErrorRates and count towards Success, StatusCodes still has them.
+	Fuzz *FuzzResults `json:"fuzz,omitempty"`
+
+	// ErrorRates shows whether errors clustered at the start, end or throughout,
+	// only set when Config.ErrorWindow is
+	ErrorRates []ErrorRateWindow `json:"errorRates,omitempty"`
+
+	// RampProfile holds the results per band of configured rate, lowest first,
+	// only set when Config.RampBand is
+	RampProfile []RampStage `json:"rampProfile,omitempty"`
+
+	// BodySuccess is the ratio of requests that succeeded by Config.SuccessBodyRegex
+	// and FailureBodyRegex, computed separately from Success which only looks at
+	// status codes. BodyFailures counts the rest, including requests with an error.
+	// Only set when BodyChecked is.
+	BodyChecked  bool    `json:"bodyChecked"`
+	BodySuccess  float64 `json:"bodySuccess"`
+	BodyFailures uint64  `json:"bodyFailures"`
+
+	// TLSHandshake is only set with Config.MeasureTLSHandshake
+	TLSHandshake *TLSHandshakeResults `json:"tlsHandshake,omitempty"`
+
+	// LatencyBreakdown is only set with Config.MeasureLatencyBreakdown
+	LatencyBreakdown *LatencyBreakdownResults `json:"latencyBreakdown,omitempty"`
+
+	// ConnWait is only set with Config.MeasureConnWait
+	ConnWait *ConnWaitResults `json:"connWait,omitempty"`
+
+	// EmptyBodies counts 2xx responses without a body, they are successes to Vegeta
+	// but usually mean a truncated or misconfigured response, see Thresholds.FailOnEmptyBody
+	EmptyBodies uint64 `json:"emptyBodies"`
+
+	// ContentTypeMismatches counts responses not matching Config.ExpectContentType
+	ContentTypeMismatches uint64 `json:"contentTypeMismatches"`
+
+	// ConfiguredRate is Config.Rate in requests per second, whatever Config.RatePer is.
+	// RateDeficit is the fraction of the configured rate that was not achieved,
+	// GeneratorLimited is set when it is more than Config.RateTolerance.
+	// This usually means this machine or its network could not keep up,
+	// so the latencies describe the generator as much as the target.
+	ConfiguredRate   float64 `json:"configuredRate"`
+	RateDeficit      float64 `json:"rateDeficit"`
+	GeneratorLimited bool    `json:"generatorLimited"`
+
+	// Interrupted is set when the attack was stopped before the end of Duration.
+	// Abandoned counts requests still in flight when ShutdownTimeout ran out,
+	// they are not included in any other field.
+	Interrupted bool   `json:"interrupted"`
+	Abandoned   uint64 `json:"abandoned"`
+
+	GeneratorStats GeneratorStats `json:"generatorStats"`
+
+	// DeadlineExceeded is set when Config.Deadline stopped the run,
+	// Interrupted is set as well
+	DeadlineExceeded bool `json:"deadlineExceeded"`
+
+	// IPVersion is Config.IPVersion, the stack every connection used, empty when Go picked
+	IPVersion string `json:"ipVersion,omitempty"`
+
+	// BytesInCapped is set when the attack was stopped by Config.MaxBytesIn,
+	// Interrupted is set as well
+	BytesInCapped bool `json:"bytesInCapped"`
+
+	// Paused is the time the attack was held through Config.Pauses. It counts
+	// toward Duration, so Rate is lower than the configured rate by that much.
+	Paused time.Duration `json:"paused"`
+
+	// Excluded counts requests sent during Config.ExcludeFirst,
+	// they are not included in any other field
+	Excluded uint64 `json:"excluded"`
+
+	// FileLimitErrors counts requests that failed because this process ran out
+	// of file descriptors, a problem with the generator and not the target
+	FileLimitErrors uint64 `json:"fileLimitErrors"`
+
+	// SimulatedErrors counts requests failed on purpose by Config.NetworkSim,
+	// they are also counted in Failures
+	SimulatedErrors uint64 `json:"simulatedErrors"`
+}
+
+func newResults(metrics *vegeta.Metrics) Results {
+	results := Results{
+		Latencies: LatencyResults{
+			Total: metrics.Latencies.Total,
+			Mean:  metrics.Latencies.Mean,
+			Min:   metrics.Latencies.Min,
+			Max:   metrics.Latencies.Max,
+			P50:   metrics.Latencies.P50,
+			P90:   metrics.Latencies.P90,
+			P95:   metrics.Latencies.P95,
+			P99:   metrics.Latencies.P99,
+			P999:  metrics.Latencies.Quantile(0.999),
+			P9999: metrics.Latencies.Quantile(0.9999),
+
+			Samples: metrics.Requests,
+		},
+		BytesIn:     metrics.BytesIn.Total,
+		BytesOut:    metrics.BytesOut.Total,
+		Success:     metrics.Success,
+		Rate:        metrics.Rate,
+		Throughput:  metrics.Throughput,
+		Duration:    metrics.Duration,
+		Wait:        metrics.Wait,
+		Requests:    metrics.Requests,
+		StatusCodes: metrics.StatusCodes,
+		Errors:      metrics.Errors,
+	}
+	if metrics.Requests == 0 {
+		// Quantiles of an empty digest are NaN
+		results.Latencies.P999, results.Latencies.P9999 = 0, 0
+	}
+	if elapsed := (metrics.Duration + metrics.Wait).Seconds(); elapsed > 0 {
+		results.ByteThroughput.In = float64(metrics.BytesIn.Total) / elapsed
+		results.ByteThroughput.Out = float64(metrics.BytesOut.Total) / elapsed
+	}
+	return results
+}
+
+// MaxPrecision is the most decimal places Round rounds to
+const MaxPrecision = 9
+
+// Round returns the results with rates rounded to places decimal places and
+// latencies to places decimal places of a millisecond, for reports that diff
+// cleanly. A negative places returns them unchanged, places above MaxPrecision
+// round to MaxPrecision.
+func (r Results) Round(places int) Results {
+	if places < 0 {
+		return r
+	}
+	places = min(places, MaxPrecision)
+	scale := math.Pow10(places)
+	rate := func(v float64) float64 {
+		return math.Round(v*scale) / scale
+	}
+	latency := func(d time.Duration) time.Duration {
+		if places >= 6 {
+			// Nanoseconds already are 6 places of a millisecond
+			return d
+		}
+		return d.Round(time.Millisecond / time.Duration(scale))
+	}
+	phase := func(p PhaseLatency) PhaseLatency {
+		p.Mean, p.P50, p.P90, p.P99, p.Max = latency(p.Mean), latency(p.P50), latency(p.P90), latency(p.P99), latency(p.Max)
+		return p
+	}
+
+	r.Rate = rate(r.Rate)
+	r.Throughput = rate(r.Throughput)
+	r.ConfiguredRate = rate(r.ConfiguredRate)
+	r.ByteThroughput.In = rate(r.ByteThroughput.In)
+	r.ByteThroughput.Out = rate(r.ByteThroughput.Out)
+	l := &r.Latencies
+	for _, d := range []*time.Duration{&l.Total, &l.Mean, &l.Min, &l.Max, &l.P50, &l.P90, &l.P95, &l.P99, &l.P999, &l.P9999} {
+		*d = latency(*d)
+	}
+	if r.LatenciesMs != nil {
+		ms := r.Latencies.Milliseconds()
+		r.LatenciesMs = &ms
+	}
+	if b := r.LatencyBreakdown; b != nil {
+		r.LatencyBreakdown = &LatencyBreakdownResults{
+			DNS:      phase(b.DNS),
+			Connect:  phase(b.Connect),
+			TLS:      phase(b.TLS),
+			TTFB:     phase(b.TTFB),
+			Transfer: phase(b.Transfer),
+		}
+	}
+	if h := r.TLSHandshake; h != nil {
+		rounded := *h
+		rounded.Mean, rounded.P50, rounded.P90, rounded.P99, rounded.Max = latency(h.Mean), latency(h.P50), latency(h.P90), latency(h.P99), latency(h.Max)
+		r.TLSHandshake = &rounded
+	}
+	if w := r.ConnWait; w != nil {
+		r.ConnWait = &ConnWaitResults{Requests: w.Requests, Waited: w.Waited, Total: latency(w.Total), Wait: phase(w.Wait)}
+	}
+	r.RampProfile = slices.Clone(r.RampProfile)
+	for i := range r.RampProfile {
+		stage := &r.RampProfile[i]
+		stage.ConfiguredRate = rate(stage.ConfiguredRate)
+		stage.AchievedRate = rate(stage.AchievedRate)
+		stage.Latencies = phase(stage.Latencies)
+	}
+	return r
+}
+
+// Summary returns a single line for log scraping. Field names and order are stable:
+// RESULT requests=N errors=M p99=Xms success=true
+func (r Results) Summary() string {
+	p99 := float64(r.Latencies.P99) / float64(time.Millisecond)
+	return fmt.Sprintf("RESULT requests=%d errors=%d p99=%.2fms success=%t", r.Requests, r.Failures, p99, r.Success == 1)
+}
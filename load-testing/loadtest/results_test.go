@@ -0,0 +1,32 @@
+package loadtest
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRound(t *testing.T) {
+	results := Results{Rate: 150.092214, Throughput: 149.5}
+	results.Latencies.P99 = 4423817 * time.Nanosecond
+
+	rounded := results.Round(2)
+	if rounded.Rate != 150.09 || rounded.Latencies.P99 != 4420*time.Microsecond {
+		t.Errorf("Round(2) rate %v and p99 %s, want 150.09 and 4.42ms", rounded.Rate, rounded.Latencies.P99)
+	}
+	if unchanged := results.Round(-1); unchanged.Rate != results.Rate || unchanged.Latencies.P99 != results.Latencies.P99 {
+		t.Errorf("Round(-1) rate %v and p99 %s, want them unchanged", unchanged.Rate, unchanged.Latencies.P99)
+	}
+
+	// Too many places round to MaxPrecision instead of overflowing to Inf and NaN
+	for _, places := range []int{MaxPrecision + 1, 400} {
+		rounded := results.Round(places)
+		if math.IsInf(rounded.Rate, 0) || math.IsNaN(rounded.Rate) || math.Abs(rounded.Rate-results.Rate) > 1e-9 {
+			t.Errorf("Round(%d) rate %v, want %v", places, rounded.Rate, results.Rate)
+		}
+		if _, err := json.Marshal(rounded); err != nil {
+			t.Errorf("Round(%d) results do not marshal: %v", places, err)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package loadtest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxRateScheduleSize caps the size of a rate schedule file, a day of seconds fits easily
+const MaxRateScheduleSize int64 = 1024 * 1024
+
+// ParseRateSchedule reads one requests per second value per line,
+// skipping blank lines and lines starting with #
+func ParseRateSchedule(data []byte) ([]int, error) {
+	schedule := []int{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		rate, err := strconv.Atoi(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: expected a whole number of requests per second, got %q", line, text)
+		}
+		schedule = append(schedule, rate)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+func validateRateSchedule(schedule []int) error {
+	total := 0
+	for i, rate := range schedule {
+		if rate < 0 {
+			return fmt.Errorf("rate schedule second %d must not be negative, got %d", i+1, rate)
+		}
+		total += rate
+	}
+	if total == 0 {
+		return errors.New("rate schedule must send at least one request")
+	}
+	return nil
+}
+
+// schedulePacer sends rates[s] requests evenly spread over second s of the attack
+type schedulePacer struct {
+	rates    []int
+	loop     bool
+	duration time.Duration // Attack duration, 0 for none
+	cum      []uint64      // cum[s] is the requests due before second s, len(rates)+1 entries
+
+	stopped  chan struct{} // Closed by stop
+	stopOnce sync.Once
+}
+
+func newSchedulePacer(rates []int, loop bool, duration time.Duration) *schedulePacer {
+	cum := make([]uint64, len(rates)+1)
+	for s, rate := range rates {
+		cum[s+1] = cum[s] + uint64(rate)
+	}
+	return &schedulePacer{rates: rates, loop: loop, duration: duration, cum: cum, stopped: make(chan struct{})}
+}
+
+// Pace implements vegeta.Pacer, hit n is due when n requests were due before it.
+// Without loop it blocks after the last request until the end of the schedule,
+// so seconds of 0 at the end still count toward the attack. Vegeta sends a hit
+// after every wait so returning a wait would send one more request.
+func (p *schedulePacer) Pace(elapsed time.Duration, hits uint64) (time.Duration, bool) {
+	total := p.cum[len(p.rates)]
+	cycles := hits / total
+	if cycles > 0 && !p.loop {
+		end := time.Duration(len(p.rates)) * time.Second
+		if p.duration > 0 {
+			end = min(end, p.duration)
+		}
+		if elapsed < end {
+			timer := time.NewTimer(end - elapsed)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-p.stopped:
+			}
+		}
+		return 0, true
+	}
+	rem := hits - cycles*total
+	// The second whose requests include hit rem, it always has a rate above 0
+	s := sort.Search(len(p.rates), func(s int) bool { return p.cum[s+1] > rem })
+	offset := float64(rem-p.cum[s]) / float64(p.rates[s])
+	due := time.Duration(cycles)*time.Duration(len(p.rates))*time.Second +
+		time.Duration(s)*time.Second + time.Duration(math.Round(offset*float64(time.Second)))
+	if due <= elapsed {
+		return 0, false
+	}
+	return due - elapsed, false
+}
+
+// stop releases a Pace waiting for the end of the schedule
+func (p *schedulePacer) stop() {
+	p.stopOnce.Do(func() { close(p.stopped) })
+}
+
+// Rate implements vegeta.Pacer
+func (p *schedulePacer) Rate(elapsed time.Duration) float64 {
+	s := int(elapsed / time.Second)
+	if s >= len(p.rates) {
+		if !p.loop {
+			return 0
+		}
+		s %= len(p.rates)
+	}
+	return float64(p.rates[s])
+}
+
+// meanRate returns the requests per second the schedule averages over d
+func (p *schedulePacer) meanRate(d time.Duration) float64 {
+	seconds := int((d + time.Second - 1) / time.Second)
+	if !p.loop {
+		seconds = min(seconds, len(p.rates))
+	}
+	var sum uint64
+	for s := 0; s < seconds; s++ {
+		sum += uint64(p.rates[s%len(p.rates)])
+	}
+	return float64(sum) / float64(seconds)
+}
@@ -0,0 +1,40 @@
+package loadtest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulePacerTrailingZeros(t *testing.T) {
+	pacer := newSchedulePacer([]int{100, 0, 0, 0}, false, time.Minute)
+
+	// The last request is due in the first second, the attack still lasts the file's 4
+	if wait, stop := pacer.Pace(990*time.Millisecond, 99); stop || wait != 0 {
+		t.Errorf("Pace of the last request returned %s and stop %t, want it due", wait, stop)
+	}
+	began := time.Now()
+	if _, stop := pacer.Pace(3900*time.Millisecond, 100); !stop {
+		t.Error("Pace after the last request did not stop")
+	}
+	if waited := time.Since(began); waited < 90*time.Millisecond {
+		t.Errorf("Pace after the last request stopped after %s, want it to wait out the 100ms to the end", waited)
+	}
+	if _, stop := pacer.Pace(4*time.Second, 100); !stop {
+		t.Error("Pace at the end did not stop")
+	}
+
+	// A shorter attack duration ends the wait first, and stop releases it
+	pacer = newSchedulePacer([]int{100, 0, 0, 0}, false, time.Second)
+	began = time.Now()
+	pacer.Pace(990*time.Millisecond, 100)
+	if waited := time.Since(began); waited > time.Second {
+		t.Errorf("Pace waited %s past a 1s attack", waited)
+	}
+	pacer = newSchedulePacer([]int{100, 0, 0, 0}, false, time.Minute)
+	pacer.stop()
+	began = time.Now()
+	pacer.Pace(time.Second, 100)
+	if waited := time.Since(began); waited > time.Second {
+		t.Errorf("stopped Pace waited %s", waited)
+	}
+}
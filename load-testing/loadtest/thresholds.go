@@ -0,0 +1,64 @@
+package loadtest
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Thresholds are the pass/fail criteria checked after a load test.
+// Zero values are not checked.
+type Thresholds struct {
+	MinThroughput float64 // Successful requests per second
+	MinRate       float64 // Requests sent per second
+
+	// MaxP99 is the latency budget of the target, the 99th percentile must not be above it
+	MaxP99 time.Duration
+
+	// FailOnEmptyBody fails the test when any 2xx response had an empty body
+	FailOnEmptyBody bool
+
+	// ReliablePercentiles fails the test when there were fewer requests than Config.MinSamples
+	ReliablePercentiles bool
+}
+
+func (t Thresholds) validate() error {
+	if t.MinThroughput < 0 {
+		return fmt.Errorf("minimum throughput must not be negative, got %f", t.MinThroughput)
+	}
+	if t.MinRate < 0 {
+		return fmt.Errorf("minimum rate must not be negative, got %f", t.MinRate)
+	}
+	if t.MaxP99 < 0 {
+		return fmt.Errorf("maximum p99 latency must not be negative, got %s", t.MaxP99)
+	}
+	return nil
+}
+
+// Check returns a message for every threshold the results did not meet,
+// an empty slice means the load test passed
+func (t Thresholds) Check(results Results) []string {
+	failures := []string{}
+	if t.MinThroughput > 0 && results.Throughput < t.MinThroughput {
+		failures = append(failures, fmt.Sprintf("throughput %s/s is below the required %.2f/s", exactFloat(results.Throughput), t.MinThroughput))
+	}
+	if t.MinRate > 0 && results.Rate < t.MinRate {
+		failures = append(failures, fmt.Sprintf("rate %s/s is below the required %.2f/s", exactFloat(results.Rate), t.MinRate))
+	}
+	if t.MaxP99 > 0 && results.Latencies.P99 > t.MaxP99 {
+		failures = append(failures, fmt.Sprintf("p99 latency %s is above the budget of %s", results.Latencies.P99, t.MaxP99))
+	}
+	if t.FailOnEmptyBody && results.EmptyBodies > 0 {
+		failures = append(failures, fmt.Sprintf("%d 2xx responses had an empty body", results.EmptyBodies))
+	}
+	if t.ReliablePercentiles && !results.Latencies.Reliable {
+		failures = append(failures, fmt.Sprintf("only %d samples, too few for reliable percentiles", results.Latencies.Samples))
+	}
+	return failures
+}
+
+// exactFloat prints v with as many decimal places as it takes, so a value just
+// below a threshold does not print the same as the threshold
+func exactFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,21 @@
+package loadtest
+
+import "strings"
+
+// timeoutMarkers are in the errors of requests that ran out of time:
+// Config.Timeout, a context deadline or a socket read or write deadline
+var timeoutMarkers = []string{
+	"Client.Timeout exceeded",
+	"context deadline exceeded",
+	"i/o timeout",
+}
+
+// IsTimeoutError reports whether a result error was a timeout
+func IsTimeoutError(err string) bool {
+	for _, marker := range timeoutMarkers {
+		if strings.Contains(err, marker) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package loadtest
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+// TLSConfig restricts the TLS versions and cipher suites used for https targets.
+// Empty fields use Go's defaults.
+type TLSConfig struct {
+	MinVersion string // "1.0", "1.1", "1.2" or "1.3"
+	MaxVersion string // "1.0", "1.1", "1.2" or "1.3"
+
+	// CipherSuites are names from crypto/tls, for example "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256".
+	// They only apply up to TLS 1.2, Go does not allow choosing TLS 1.3 cipher suites.
+	CipherSuites []string
+
+	// ServerName overrides the SNI, which otherwise comes from the URI host.
+	// Needed when the URI host is an IP address.
+	ServerName string
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func (t TLSConfig) validate() error {
+	for _, version := range []string{t.MinVersion, t.MaxVersion} {
+		if _, ok := tlsVersions[version]; version != "" && !ok {
+			return fmt.Errorf("unknown TLS version %q, use 1.0, 1.1, 1.2 or 1.3", version)
+		}
+	}
+	if t.MinVersion != "" && t.MaxVersion != "" && tlsVersions[t.MinVersion] > tlsVersions[t.MaxVersion] {
+		return fmt.Errorf("TLS min version %s is above max version %s", t.MinVersion, t.MaxVersion)
+	}
+	for _, name := range t.CipherSuites {
+		if _, ok := cipherSuiteID(name); !ok {
+			return fmt.Errorf("unknown TLS cipher suite %q", name)
+		}
+	}
+	if t.ServerName != "" && !validServerName(t.ServerName) {
+		return fmt.Errorf("invalid TLS server name %q, must be a hostname", t.ServerName)
+	}
+	return nil
+}
+
+// validServerName checks name looks like a DNS hostname: dot separated labels
+// of letters, digits and hyphens, not an IP address (SNI cannot carry one)
+func validServerName(name string) bool {
+	if len(name) > 253 || net.ParseIP(name) != nil {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isSet reports whether any TLS setting differs from Go's defaults
+func (t TLSConfig) isSet() bool {
+	return t.MinVersion != "" || t.MaxVersion != "" || len(t.CipherSuites) > 0 || t.ServerName != ""
+}
+
+// clientConfig returns the tls.Config to use, starting from Vegeta's default
+// so certificates stay unverified like in a plain attack
+func (t TLSConfig) clientConfig() *tls.Config {
+	config := vegeta.DefaultTLSConfig.Clone()
+	config.MinVersion = tlsVersions[t.MinVersion]
+	config.MaxVersion = tlsVersions[t.MaxVersion]
+	config.ServerName = t.ServerName
+	for _, name := range t.CipherSuites {
+		id, _ := cipherSuiteID(name)
+		config.CipherSuites = append(config.CipherSuites, id)
+	}
+	return config
+}
+
+// cipherSuiteID looks up a cipher suite by name, including the insecure ones
+// so their behavior can be tested
+func cipherSuiteID(name string) (uint16, bool) {
+	for _, suites := range [][]*tls.CipherSuite{tls.CipherSuites(), tls.InsecureCipherSuites()} {
+		for _, suite := range suites {
+			if suite.Name == name {
+				return suite.ID, true
+			}
+		}
+	}
+	return 0, false
+}
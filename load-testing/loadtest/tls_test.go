@@ -0,0 +1,38 @@
+package loadtest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTLSSkipsVerification(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// The test server's certificate is self-signed, setting an option must not start verifying it
+	for name, cfg := range map[string]Config{
+		"default":        {},
+		"min version":    {TLS: TLSConfig{MinVersion: "1.2"}},
+		"server name":    {TLS: TLSConfig{ServerName: "example.com"}},
+		"raw URL":        {TLS: TLSConfig{MaxVersion: "1.3"}, RawURL: true},
+		"custom client":  {ReadBufferSize: 8192},
+		"tls handshakes": {MeasureTLSHandshake: true},
+	} {
+		cfg.URI = server.URL + "/"
+		cfg.Rate = 20
+		cfg.Duration = 500 * time.Millisecond
+		cfg.Timeout = 5 * time.Second
+		results, err := RunContext(context.Background(), cfg)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if results.Requests == 0 || results.Failures != 0 {
+			t.Errorf("%s: %d requests, %d failures, want requests and no failures", name, results.Requests, results.Failures)
+		}
+	}
+}
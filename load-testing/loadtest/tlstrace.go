@@ -0,0 +1,99 @@
+package loadtest
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/influxdata/tdigest"
+)
+
+// TLSHandshakeResults holds the TLS handshake durations of new connections.
+// Many handshakes with few reused connections, or none resumed, means every
+// request pays for a full handshake.
+type TLSHandshakeResults struct {
+	Handshakes uint64        `json:"handshakes"`
+	Resumed    uint64        `json:"resumed"` // Handshakes that resumed a TLS session
+	Mean       time.Duration `json:"mean"`
+	P50        time.Duration `json:"p50"`
+	P90        time.Duration `json:"p90"`
+	P99        time.Duration `json:"p99"`
+	Max        time.Duration `json:"max"`
+
+	// Requests sent on a new connection and on a reused one
+	NewConnections    uint64 `json:"newConnections"`
+	ReusedConnections uint64 `json:"reusedConnections"`
+}
+
+// handshakeRecorder collects handshake durations from every worker
+type handshakeRecorder struct {
+	mu      sync.Mutex
+	results TLSHandshakeResults
+	total   time.Duration
+	digest  *tdigest.TDigest
+}
+
+func newHandshakeRecorder() *handshakeRecorder {
+	return &handshakeRecorder{digest: tdigest.NewWithCompression(100)}
+}
+
+func (r *handshakeRecorder) gotConn(info httptrace.GotConnInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if info.Reused {
+		r.results.ReusedConnections++
+	} else {
+		r.results.NewConnections++
+	}
+}
+
+func (r *handshakeRecorder) handshake(d time.Duration, state tls.ConnectionState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results.Handshakes++
+	if state.DidResume {
+		r.results.Resumed++
+	}
+	if d > r.results.Max {
+		r.results.Max = d
+	}
+	r.total += d
+	r.digest.Add(float64(d), 1)
+}
+
+func (r *handshakeRecorder) summary() *TLSHandshakeResults {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	results := r.results
+	if results.Handshakes > 0 {
+		results.Mean = r.total / time.Duration(results.Handshakes)
+		results.P50 = time.Duration(r.digest.Quantile(0.50))
+		results.P90 = time.Duration(r.digest.Quantile(0.90))
+		results.P99 = time.Duration(r.digest.Quantile(0.99))
+	}
+	return &results
+}
+
+// tlsTraceTransport records connection reuse and TLS handshakes with httptrace
+type tlsTraceTransport struct {
+	recorder *handshakeRecorder
+	next     http.RoundTripper
+}
+
+func (t *tlsTraceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var started time.Time
+	trace := &httptrace.ClientTrace{
+		GotConn: t.recorder.gotConn,
+		TLSHandshakeStart: func() {
+			started = time.Now()
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err == nil && !started.IsZero() {
+				t.recorder.handshake(time.Since(started), state)
+			}
+		},
+	}
+	return t.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
@@ -0,0 +1,100 @@
+package loadtest
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// writtenPath returns the path portion of a URI exactly as written,
+// without the scheme, authority, query or fragment
+func writtenPath(uri string) string {
+	rest := uri
+	if i := strings.Index(rest, "://"); i >= 0 {
+		rest = rest[i+3:]
+		if j := strings.IndexAny(rest, "/?#"); j >= 0 {
+			rest = rest[j:]
+		} else {
+			rest = ""
+		}
+	}
+	if i := strings.IndexAny(rest, "?#"); i >= 0 {
+		rest = rest[:i]
+	}
+	return rest
+}
+
+// writtenRequestURI returns the path and query of a URI exactly as written
+func writtenRequestURI(uri string) string {
+	query := ""
+	if i := strings.Index(uri, "?"); i >= 0 {
+		query = uri[i:]
+		if j := strings.Index(query, "#"); j >= 0 {
+			query = query[:j]
+		}
+	}
+	return writtenPath(uri) + query
+}
+
+// sentRequestURI returns the path and query Go will put on the request line
+func sentRequestURI(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	return u.RequestURI(), nil
+}
+
+// RequestURIs returns the path and query of a URI as written and as Go will send it.
+// They differ when Go normalizes the URI, see notes/url_normalization.md
+func RequestURIs(uri string) (written string, sent string, err error) {
+	sent, err = sentRequestURI(uri)
+	if err != nil {
+		return "", "", err
+	}
+	return writtenRequestURI(uri), sent, nil
+}
+
+// rawURLTransport sends paths exactly as written in the URI or the replayed URLs,
+// bypassing the escaping Go applies when it parses them
+type rawURLTransport struct {
+	paths map[string]string // written path by the escaped path Go would send
+	next  http.RoundTripper
+}
+
+// newRawURLTransport maps the path Go sends for the URI and every Config.Replay
+// URL back to the path as written. When two written paths parse to the same one,
+// the first is sent for both.
+func newRawURLTransport(cfg Config, next http.RoundTripper) *rawURLTransport {
+	uris := []string{cfg.URI}
+	for _, req := range cfg.Replay {
+		uris = append(uris, req.URL)
+	}
+	paths := map[string]string{}
+	for _, uri := range uris {
+		u, err := url.Parse(uri)
+		written := writtenPath(uri)
+		if err != nil || written == "" {
+			continue
+		}
+		if _, ok := paths[u.EscapedPath()]; !ok {
+			paths[u.EscapedPath()] = written
+		}
+	}
+	return &rawURLTransport{paths: paths, next: next}
+}
+
+func (t *rawURLTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path, ok := t.paths[req.URL.EscapedPath()]
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	if strings.HasPrefix(path, "//") {
+		// Opaque values starting with "//" are sent in absolute form
+		req.URL.Opaque = "//" + req.URL.Host + path
+	} else {
+		req.URL.Opaque = path
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,47 @@
+package loadtest
+
+import (
+	"runtime"
+	"time"
+)
+
+// GeneratorStats holds the resources this process used during the run, to tell
+// whether the generator rather than the target was the bottleneck. CPU time and
+// PeakRSS are zero where getrusage is not available (Windows).
+type GeneratorStats struct {
+	CPUTime time.Duration `json:"cpuTime"` // User and system CPU time spent during the run
+
+	// CPUUtilization is CPUTime over the run's wall time and CPUs,
+	// close to 1 means every core was busy
+	CPUUtilization float64 `json:"cpuUtilization"`
+	CPUs           int     `json:"cpus"`
+
+	PeakRSS  uint64 `json:"peakRSS"`  // Highest resident memory of the process so far in bytes, not only this run
+	GoMemory uint64 `json:"goMemory"` // Memory obtained from the OS by the Go runtime at the end of the run in bytes
+}
+
+// usageStart is the CPU time and wall clock at the start of a run
+type usageStart struct {
+	cpu  time.Duration
+	wall time.Time
+}
+
+func startUsage() usageStart {
+	cpu, _, _ := processUsage()
+	return usageStart{cpu: cpu, wall: time.Now()}
+}
+
+func (u usageStart) stats() GeneratorStats {
+	stats := GeneratorStats{CPUs: runtime.NumCPU()}
+	if cpu, peakRSS, ok := processUsage(); ok {
+		stats.CPUTime = cpu - u.cpu
+		stats.PeakRSS = peakRSS
+		if wall := time.Since(u.wall); wall > 0 {
+			stats.CPUUtilization = stats.CPUTime.Seconds() / wall.Seconds() / float64(stats.CPUs)
+		}
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	stats.GoMemory = mem.Sys
+	return stats
+}
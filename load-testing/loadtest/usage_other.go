@@ -0,0 +1,9 @@
+//go:build !unix
+
+package loadtest
+
+import "time"
+
+func processUsage() (time.Duration, uint64, bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package loadtest
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// processUsage returns the CPU time and peak resident memory of this process
+func processUsage() (time.Duration, uint64, bool) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, 0, false
+	}
+	cpu := time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+	peakRSS := uint64(usage.Maxrss)
+	if runtime.GOOS != "darwin" && runtime.GOOS != "ios" {
+		// Kilobytes everywhere but Apple platforms
+		peakRSS *= 1024
+	}
+	return cpu, peakRSS, true
+}
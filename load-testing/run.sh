@@ -9,7 +9,7 @@ go vet ./...;
 #gosec -quiet -color -tests ./...;
 #golint ./...; # -v
 go mod tidy;
-go run -race ./cmd/load-test/main.go;
+go run -race ./cmd/load-test/ "$@";
 
 # # Static Version
 # # Use this to deploy to multiple machines in a cluster
@@ -17,4 +17,4 @@ go run -race ./cmd/load-test/main.go;
 # # -ldflags="-extldflags=-static"
 # #
 # mkdir -p ./bin/;
-# CGO_ENABLED=0 go build -o ./bin/load-test.bin -ldflags='-s -w' ./cmd/load-test/main.go;
+# CGO_ENABLED=0 go build -o ./bin/load-test.bin -ldflags='-s -w' ./cmd/load-test/;